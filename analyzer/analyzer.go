@@ -0,0 +1,144 @@
+// Package analyzer reports functions that are not instrumented, with suggested fixes that instrument them.
+// It works with go vet -vettool and gopls, see cmd/go-instrument-vet.
+package analyzer
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"maps"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+
+	"github.com/nikolaydubina/go-instrument/internal/config"
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+var Analyzer = &analysis.Analyzer{
+	Name: "instrument",
+	Doc: `report functions with context that are not instrumented
+
+Functions that take context, or *http.Request, and do not start span are reported,
+with suggested fix that inserts the same statements as go-instrument. Generated files are skipped.
+Flags are the same as flags of go-instrument, and are set by the same config files.`,
+	URL: "https://github.com/nikolaydubina/go-instrument",
+	Run: run,
+}
+
+var (
+	configName string
+	flagArgs   []flagArg
+)
+
+// flagArg is flag set in command line, it is applied over config file of each package
+type flagArg struct{ name, value string }
+
+// recordedFlag records flag set in command line, and checks its value
+type recordedFlag struct {
+	flag.Value
+	name string
+}
+
+func (s recordedFlag) Set(v string) error {
+	if err := s.Value.Set(v); err != nil {
+		return err
+	}
+	flagArgs = append(flagArgs, flagArg{name: s.name, value: v})
+	return nil
+}
+
+func (s recordedFlag) IsBoolFlag() bool {
+	v, ok := s.Value.(interface{ IsBoolFlag() bool })
+	return ok && v.IsBoolFlag()
+}
+
+func init() {
+	Analyzer.Flags.StringVar(&configName, "config", "", "config file with flags as keys, by default "+strings.Join(config.FileNames, " or ")+" is searched in directory of package and its parents")
+
+	var opts config.Options
+	flags := flag.NewFlagSet("instrument", flag.ContinueOnError)
+	opts.RegisterFlags(flags)
+	flags.VisitAll(func(f *flag.Flag) {
+		Analyzer.Flags.Var(recordedFlag{Value: f.Value, name: f.Name}, f.Name, f.Usage)
+	})
+}
+
+// packageOptions are options of command line applied over config file of package
+func packageOptions(pass *analysis.Pass) (config.Options, error) {
+	var opts config.Options
+	flags := flag.NewFlagSet("instrument", flag.ContinueOnError)
+	opts.RegisterFlags(flags)
+	for _, q := range flagArgs {
+		if err := flags.Set(q.name, q.value); err != nil {
+			return opts, err
+		}
+	}
+
+	fileName := configName
+	if fileName == "" && len(pass.Files) > 0 {
+		var err error
+		if fileName, err = config.Find(filepath.Dir(pass.Fset.Position(pass.Files[0].Pos()).Filename)); err != nil {
+			return opts, err
+		}
+	}
+	if fileName != "" {
+		if err := config.Apply(flags, fileName); err != nil {
+			return opts, err
+		}
+	}
+
+	return opts, opts.Validate()
+}
+
+func run(pass *analysis.Pass) (any, error) {
+	opts, err := packageOptions(pass)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, file := range pass.Files {
+		if ast.IsGenerated(file) {
+			continue
+		}
+
+		p, err := opts.NewProcessor()
+		if err != nil {
+			return nil, err
+		}
+		p.PackagePath, p.Types, p.TypesInfo = pass.Pkg.Path(), pass.Pkg, pass.TypesInfo
+		p.PackageNames = make(map[string]bool)
+		for _, other := range pass.Files {
+			if other != file {
+				maps.Copy(p.PackageNames, processor.DeclaredNames(other))
+			}
+		}
+
+		fixes, err := p.Fixes(pass.Fset, file)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, fix := range fixes {
+			var edits []analysis.TextEdit
+			for _, q := range fix.Edits {
+				edits = append(edits, analysis.TextEdit{Pos: q.Pos, End: q.End, NewText: q.NewText})
+			}
+
+			pos := fix.Func.Type.Pos()
+			if fix.Func.Decl != nil {
+				pos = fix.Func.Decl.Name.Pos()
+			}
+
+			pass.Report(analysis.Diagnostic{
+				Pos:     pos,
+				Message: fmt.Sprintf("%s is not instrumented", fix.Func.SpanName),
+				SuggestedFixes: []analysis.SuggestedFix{
+					{Message: "Instrument " + fix.Func.SpanName, TextEdits: edits},
+				},
+			})
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,28 @@
+package a
+
+import (
+	"context"
+	"errors"
+	"net/http"
+)
+
+type Cat struct{}
+
+func (c Cat) Name(ctx context.Context) (name string, err error) { // want `Cat.Name is not instrumented`
+	if name == "" {
+		return "", errors.New("no name")
+	}
+	return name, nil
+}
+
+func Handle(w http.ResponseWriter, r *http.Request) { // want `Handle is not instrumented`
+	w.WriteHeader(http.StatusOK)
+}
+
+func Fetch(ctx context.Context) {} // want `Fetch is not instrumented`
+
+func NoContext() {
+	_ = func(ctx context.Context) { // want `NoContext.func1 is not instrumented`
+		Fetch(ctx)
+	}
+}
@@ -0,0 +1,17 @@
+package b
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+)
+
+func Instrumented(ctx context.Context) {
+	ctx, span := otel.Tracer("app").Start(ctx, "Instrumented")
+	defer span.End()
+	_ = ctx
+}
+
+func Fetch(ctx context.Context) { // want `Fetch is not instrumented`
+	_ = ctx
+}
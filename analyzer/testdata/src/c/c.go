@@ -0,0 +1,13 @@
+package c
+
+import (
+	"context"
+)
+
+func Fetch(ctx context.Context) error { // want `Fetch is not instrumented`
+	return nil
+}
+
+func Skipped(ctx context.Context) error {
+	return nil
+}
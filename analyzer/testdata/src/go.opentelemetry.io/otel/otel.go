@@ -0,0 +1,16 @@
+// Package otel is minimal stub of OpenTelemetry API for tests
+package otel
+
+import "context"
+
+type Span struct{}
+
+func (Span) End() {}
+
+type TracerProvider struct{}
+
+func (TracerProvider) Start(ctx context.Context, name string) (context.Context, Span) {
+	return ctx, Span{}
+}
+
+func Tracer(name string) TracerProvider { return TracerProvider{} }
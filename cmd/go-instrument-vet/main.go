@@ -0,0 +1,12 @@
+// Command go-instrument-vet reports functions with context that are not instrumented.
+//
+//	go vet -vettool=$(which go-instrument-vet) ./...
+package main
+
+import (
+	"golang.org/x/tools/go/analysis/singlechecker"
+
+	"github.com/nikolaydubina/go-instrument/analyzer"
+)
+
+func main() { singlechecker.Main(analyzer.Analyzer) }
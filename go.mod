@@ -1,5 +1,14 @@
 module github.com/nikolaydubina/go-instrument
 
-go 1.24
+go 1.25.0
 
-require golang.org/x/tools v0.35.0
+require (
+	golang.org/x/mod v0.26.0
+	golang.org/x/tools v0.35.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	go.opentelemetry.io/otel/trace v1.46.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
+)
@@ -0,0 +1,88 @@
+package instrument
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+// Datadog instruments functions with native dd-trace-go spans
+type Datadog struct {
+	ServiceName string
+
+	hasInserts bool
+}
+
+func (s *Datadog) Imports() []*types.Package {
+	if !s.hasInserts {
+		return nil
+	}
+	return []*types.Package{
+		types.NewPackage("gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer", "ddTracer"),
+	}
+}
+
+func (s *Datadog) PrefixStatements(spanName string, contextName string, hasError bool, errorName string) []ast.Stmt {
+	return s.prefixStatements(spanName, contextName, "span", &ast.Ident{Name: contextName}, hasError, errorName)
+}
+
+func (s *Datadog) FuncPrefixStatements(fn processor.FuncInfo) []ast.Stmt {
+	return s.prefixStatements(fn.SpanName, fn.ContextName, fn.UnusedName("span"), fn.ParentContext(), fn.HasError, fn.ErrorName)
+}
+
+func (s *Datadog) prefixStatements(spanName string, contextName string, spanVar string, parentContext ast.Expr, hasError bool, errorName string) []ast.Stmt {
+	s.hasInserts = true
+
+	stmts := []ast.Stmt{
+		&ast.AssignStmt{
+			Tok: token.DEFINE,
+			Lhs: []ast.Expr{&ast.Ident{Name: spanVar}, &ast.Ident{Name: contextName}},
+			Rhs: []ast.Expr{s.exprStartSpan(spanName, parentContext)},
+		},
+	}
+	if hasError {
+		// error has to be evaluated on exit, hence closure.
+		// nil of concrete error type is not nil error, hence it is checked before conversion.
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: &ast.FuncLit{
+			Type: &ast.FuncType{},
+			Body: &ast.BlockStmt{List: []ast.Stmt{
+				&ast.IfStmt{
+					Cond: &ast.BinaryExpr{X: &ast.Ident{Name: errorName}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+					Body: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: s.exprFinish(spanVar, errorName)}}},
+					Else: &ast.BlockStmt{List: []ast.Stmt{&ast.ExprStmt{X: s.exprFinish(spanVar, "")}}},
+				},
+			}},
+		}}})
+	} else {
+		stmts = append(stmts, &ast.DeferStmt{Call: s.exprFinish(spanVar, "")})
+	}
+	return stmts
+}
+
+func (s *Datadog) exprStartSpan(spanName string, parentContext ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "ddTracer"}, Sel: &ast.Ident{Name: "StartSpanFromContext"}},
+		Args: []ast.Expr{
+			parentContext,
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(spanName)},
+			&ast.CallExpr{
+				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "ddTracer"}, Sel: &ast.Ident{Name: "ServiceName"}},
+				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s.ServiceName)}},
+			},
+		},
+	}
+}
+
+func (s *Datadog) exprFinish(spanVar string, errorName string) *ast.CallExpr {
+	call := &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "Finish"}}}
+	if errorName != "" {
+		call.Args = []ast.Expr{&ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "ddTracer"}, Sel: &ast.Ident{Name: "WithError"}},
+			Args: []ast.Expr{&ast.Ident{Name: errorName}},
+		}}
+	}
+	return call
+}
@@ -0,0 +1,71 @@
+package instrument_test
+
+import (
+	"bytes"
+	_ "embed"
+	"go/printer"
+	"go/token"
+	"maps"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+)
+
+//go:embed testdata/datadog_error.go
+var expDatadogError string
+
+//go:embed testdata/datadog.go
+var expDatadog string
+
+func TestDatadog_Error(t *testing.T) {
+	p := instrument.Datadog{ServiceName: "app"}
+	c := p.PrefixStatements("myClass.MyFunction", "ctx", true, "err")
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expDatadogError {
+		t.Error(s)
+	}
+
+	imports := p.Imports()
+
+	expImportPaths := map[string]bool{
+		"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer ddTracer": true,
+	}
+	importPaths := importPathsFromImports(imports)
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestDatadog(t *testing.T) {
+	p := instrument.Datadog{ServiceName: "app"}
+	c := p.PrefixStatements("myClass.MyFunction", "ctx", false, "err")
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expDatadog {
+		t.Error(s)
+	}
+
+	imports := p.Imports()
+
+	expImportPaths := map[string]bool{
+		"gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer ddTracer": true,
+	}
+	importPaths := importPathsFromImports(imports)
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestDatadog_NoInserts(t *testing.T) {
+	p := instrument.Datadog{ServiceName: "app"}
+	if imports := p.Imports(); len(imports) != 0 {
+		t.Error(imports)
+	}
+}
@@ -4,30 +4,155 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/nikolaydubina/go-instrument/processor"
 )
 
+// DefaultAttributeDenyNames are parts of names of parameters that are likely sensitive and are not recorded
+var DefaultAttributeDenyNames = []string{"password", "passwd", "secret", "token", "apikey", "credential"}
+
 type OpenTelemetry struct {
 	TracerName             string
 	ErrorStatusDescription string
 
-	hasInserts bool
-	hasError   bool
+	// TracerVar is package level variable of tracer that is declared once per package, so that tracer is not looked up on every call.
+	// Existing package level variable with this name is used as is. Tracer is looked up on every call if empty.
+	TracerVar string
+
+	// ParamAttributes records parameters of basic kinds as span attributes: strings, integers, floats, bools, and named types over them.
+	ParamAttributes bool
+	// ResultAttributes records named results of basic kinds as span attributes when function returns.
+	ResultAttributes bool
+	// CodeAttributes records code.function, code.namespace, code.filepath, and code.lineno semantic convention attributes.
+	CodeAttributes bool
+	// SpanKind sets kind of span: server for http handlers and methods of gRPC servers, client for methods of ClientTypes, and internal otherwise.
+	// gRPC servers are detected when types are loaded.
+	SpanKind bool
+	// ServerTypes and ClientTypes select receivers of server and client methods by type name, e.g. Client$.
+	ServerTypes, ClientTypes []*regexp.Regexp
+	// RecordPanic records panic with stack trace and error status, and panics again with the same value.
+	RecordPanic bool
+	// AttributeTypes selects parameters and results by type as written in source, e.g. string or UserID. All basic kinds are recorded if empty.
+	AttributeTypes []string
+	// AttributeDenyNames skips parameters and results that contain any of these in name, case insensitive.
+	AttributeDenyNames []string
+	// LinkGoroutines starts spans of goroutines as new roots linked to span of function that launches them, instead of child spans.
+	LinkGoroutines bool
+
+	hasInserts        bool
+	hasError          bool
+	hasAttributes     bool
+	hasSpanOptions    bool
+	hasPanic          bool
+	hasCodeAttributes bool
 }
 
 func (s *OpenTelemetry) Imports() []*types.Package {
 	if !s.hasInserts {
 		return nil
 	}
-	pkgs := []*types.Package{
-		types.NewPackage("go.opentelemetry.io/otel", ""),
+	var pkgs []*types.Package
+	if s.TracerVar == "" {
+		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel", ""))
 	}
-	if s.hasError {
+	if s.hasError || s.hasPanic {
 		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel/codes", "otelCodes"))
 	}
+	if s.hasPanic {
+		pkgs = append(pkgs, types.NewPackage("fmt", "otelFmt"))
+	}
+	if s.hasAttributes {
+		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel/attribute", "otelAttribute"))
+	}
+	if s.hasCodeAttributes {
+		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel/semconv/v1.26.0", "otelSemconv"))
+	}
+	if s.hasSpanOptions || s.hasPanic {
+		pkgs = append(pkgs, types.NewPackage("go.opentelemetry.io/otel/trace", "otelTrace"))
+	}
 	return pkgs
 }
 
 func (s *OpenTelemetry) PrefixStatements(spanName string, contextName string, hasError bool, errorName string) []ast.Stmt {
+	return s.prefixStatements(spanName, contextName, "span", &ast.Ident{Name: contextName}, hasError, errorName, nil)
+}
+
+func (s *OpenTelemetry) FuncPrefixStatements(fn processor.FuncInfo) []ast.Stmt {
+	var attributes []ast.Expr
+	if s.CodeAttributes {
+		s.hasCodeAttributes = true
+		attributes = append(attributes, codeAttributes(fn)...)
+	}
+	if s.ParamAttributes {
+		for _, q := range fn.Params {
+			if attribute := s.attribute(q); attribute != nil {
+				s.hasAttributes = true
+				attributes = append(attributes, attribute)
+			}
+		}
+	}
+
+	var options []ast.Expr
+	if kind := s.spanKind(fn); kind != "" {
+		s.hasSpanOptions = true
+		options = append(options, &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: "WithSpanKind"}},
+			Args: []ast.Expr{&ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: kind}}},
+		})
+	}
+	if len(attributes) > 0 {
+		s.hasSpanOptions = true
+		options = append(options, &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: "WithAttributes"}},
+			Args: attributes,
+		})
+	}
+
+	if fn.Goroutine && s.LinkGoroutines {
+		s.hasSpanOptions = true
+		options = append(options,
+			&ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: "WithNewRoot"}}},
+			&ast.CallExpr{
+				Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: "WithLinks"}},
+				Args: []ast.Expr{&ast.CallExpr{
+					Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: "LinkFromContext"}},
+					Args: []ast.Expr{fn.ParentContext()},
+				}},
+			},
+		)
+	}
+
+	spanVar := fn.UnusedName("span")
+	stmts := s.prefixStatements(fn.SpanName, fn.ContextName, spanVar, fn.ParentContext(), fn.HasError, fn.ErrorName, options)
+
+	if s.ResultAttributes {
+		var attributes []ast.Expr
+		for _, q := range fn.Results {
+			if attribute := s.attribute(q); attribute != nil {
+				attributes = append(attributes, attribute)
+			}
+		}
+		if len(attributes) > 0 {
+			s.hasAttributes = true
+			stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncSetSpanAttributes(spanVar, attributes)}})
+		}
+	}
+
+	if s.RecordPanic {
+		s.hasPanic = true
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncRecordPanic(spanVar)}})
+	}
+
+	return stmts
+}
+
+func (s *OpenTelemetry) prefixStatements(spanName string, contextName string, spanVar string, parentContext ast.Expr, hasError bool, errorName string, options []ast.Expr) []ast.Stmt {
 	s.hasInserts = true
 	if hasError {
 		s.hasError = hasError
@@ -36,33 +161,262 @@ func (s *OpenTelemetry) PrefixStatements(spanName string, contextName string, ha
 	stmts := []ast.Stmt{
 		&ast.AssignStmt{
 			Tok: token.DEFINE,
-			Lhs: []ast.Expr{&ast.Ident{Name: contextName}, &ast.Ident{Name: "span"}},
-			Rhs: []ast.Expr{s.expFuncSet(s.TracerName, spanName, contextName)},
+			Lhs: []ast.Expr{&ast.Ident{Name: contextName}, &ast.Ident{Name: spanVar}},
+			Rhs: []ast.Expr{s.expFuncSet(s.TracerName, spanName, parentContext, options...)},
 		},
 		&ast.DeferStmt{Call: &ast.CallExpr{
-			Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "End"}},
+			Fun: &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "End"}},
 		}},
 	}
 	if hasError {
-		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncSetSpanError(errorName)}})
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncSetSpanError(spanVar, errorName)}})
 	}
 	return stmts
 }
 
-func (s *OpenTelemetry) expFuncSet(tracerName, spanName, contextName string) ast.Expr {
+// PackageDecls declares tracer variable, if set
+func (s *OpenTelemetry) PackageDecls() []processor.PackageDecl {
+	if s.TracerVar == "" {
+		return nil
+	}
+	return []processor.PackageDecl{{
+		Name: s.TracerVar,
+		Decl: &ast.GenDecl{
+			Tok: token.VAR,
+			Specs: []ast.Spec{&ast.ValueSpec{
+				Names:  []*ast.Ident{{Name: s.TracerVar}},
+				Values: []ast.Expr{s.exprTracer(s.TracerName)},
+			}},
+		},
+		Imports: []*types.Package{types.NewPackage("go.opentelemetry.io/otel", "")},
+	}}
+}
+
+func (s *OpenTelemetry) exprTracer(tracerName string) ast.Expr {
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otel"}, Sel: &ast.Ident{Name: "Tracer"}},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(tracerName)}},
+	}
+}
+
+func (s *OpenTelemetry) expFuncSet(tracerName, spanName string, parentContext ast.Expr, options ...ast.Expr) ast.Expr {
+	tracer := s.exprTracer(tracerName)
+	if s.TracerVar != "" {
+		tracer = &ast.Ident{Name: s.TracerVar}
+	}
 	return &ast.CallExpr{
 		Fun: &ast.SelectorExpr{
-			X: &ast.CallExpr{
-				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otel"}, Sel: &ast.Ident{Name: "Tracer"}},
-				Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"` + tracerName + `"`}},
-			},
+			X:   tracer,
 			Sel: &ast.Ident{Name: "Start"},
 		},
-		Args: []ast.Expr{&ast.Ident{Name: contextName}, &ast.BasicLit{Kind: token.STRING, Value: `"` + spanName + `"`}},
+		Args: append([]ast.Expr{parentContext, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(spanName)}}, options...),
+	}
+}
+
+func (s *OpenTelemetry) exprFuncSetSpanAttributes(spanVar string, attributes []ast.Expr) ast.Expr {
+	return &ast.FuncLit{
+		Type: &ast.FuncType{},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ExprStmt{X: &ast.CallExpr{
+				Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "SetAttributes"}},
+				Args: attributes,
+			}},
+		}},
+	}
+}
+
+func (s *OpenTelemetry) exprFuncRecordPanic(spanVar string) ast.Expr {
+	return &ast.FuncLit{
+		Type: &ast.FuncType{},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.IfStmt{
+				Init: &ast.AssignStmt{
+					Tok: token.DEFINE,
+					Lhs: []ast.Expr{&ast.Ident{Name: "r"}},
+					Rhs: []ast.Expr{&ast.CallExpr{Fun: &ast.Ident{Name: "recover"}}},
+				},
+				Cond: &ast.BinaryExpr{X: &ast.Ident{Name: "r"}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ExprStmt{X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "RecordError"}},
+						Args: []ast.Expr{
+							&ast.CallExpr{
+								Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelFmt"}, Sel: &ast.Ident{Name: "Errorf"}},
+								Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"%v"`}, &ast.Ident{Name: "r"}},
+							},
+							&ast.CallExpr{
+								Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelTrace"}, Sel: &ast.Ident{Name: "WithStackTrace"}},
+								Args: []ast.Expr{&ast.Ident{Name: "true"}},
+							},
+						},
+					}},
+					&ast.ExprStmt{X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "SetStatus"}},
+						Args: []ast.Expr{
+							&ast.SelectorExpr{X: &ast.Ident{Name: "otelCodes"}, Sel: &ast.Ident{Name: "Error"}},
+							&ast.BasicLit{Kind: token.STRING, Value: `"panic"`},
+						},
+					}},
+					&ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.Ident{Name: "panic"}, Args: []ast.Expr{&ast.Ident{Name: "r"}}}},
+				}},
+			},
+		}},
+	}
+}
+
+// spanKind is name of span kind constant in trace package, or empty for internal
+func (s *OpenTelemetry) spanKind(fn processor.FuncInfo) string {
+	if !s.SpanKind {
+		return ""
+	}
+	// anonymous functions within methods are not methods
+	receiver, _, _ := strings.Cut(fn.Name.Receiver, "[")
+	matches := func(r *regexp.Regexp) bool { return fn.Receiver != nil && r.MatchString(receiver) }
+	switch {
+	case isHTTPHandler(fn), isGRPCServerMethod(fn), slices.ContainsFunc(s.ServerTypes, matches):
+		return "SpanKindServer"
+	case slices.ContainsFunc(s.ClientTypes, matches):
+		return "SpanKindClient"
+	default:
+		return ""
+	}
+}
+
+// isHTTPHandler checks function has signature of http.HandlerFunc
+func isHTTPHandler(fn processor.FuncInfo) bool {
+	return len(fn.Params) == 2 && len(fn.Results) == 0 &&
+		isType(fn.Params[0], "net/http", "ResponseWriter", false) &&
+		isType(fn.Params[1], "net/http", "Request", true)
+}
+
+// isType checks variable is of named type by type information, otherwise as written in source
+func isType(v processor.Var, pkgPath, name string, pointer bool) bool {
+	if v.Type != nil {
+		t := v.Type
+		if pointer {
+			p, ok := t.(*types.Pointer)
+			if !ok {
+				return false
+			}
+			t = p.Elem()
+		}
+		named, ok := t.(*types.Named)
+		return ok && named.Obj().Pkg() != nil && named.Obj().Pkg().Path() == pkgPath && named.Obj().Name() == name
+	}
+	exp := path.Base(pkgPath) + "." + name
+	if pointer {
+		exp = "*" + exp
+	}
+	return types.ExprString(v.Expr) == exp
+}
+
+// isGRPCServerMethod checks method implements method of embedded Unimplemented<Service>Server of gRPC generated code.
+// This requires types.
+func isGRPCServerMethod(fn processor.FuncInfo) bool {
+	if fn.Receiver == nil || fn.Receiver.Type == nil {
+		return false
+	}
+	t := fn.Receiver.Type
+	if _, ok := t.(*types.Pointer); !ok {
+		t = types.NewPointer(t)
+	}
+	methods := types.NewMethodSet(t)
+	for i := range methods.Len() {
+		m := methods.At(i)
+		if name := m.Obj().Name(); !strings.HasPrefix(name, "mustEmbedUnimplemented") || !strings.HasSuffix(name, "Server") {
+			continue
+		}
+		unimplemented := m.Obj().(*types.Func).Signature().Recv().Type()
+		if _, ok := unimplemented.(*types.Pointer); !ok {
+			unimplemented = types.NewPointer(unimplemented)
+		}
+		if types.NewMethodSet(unimplemented).Lookup(nil, fn.Name.Function) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// codeAttributes makes code.* attributes, namespace and file are qualified by import path as in runtime and -trimpath builds
+func codeAttributes(fn processor.FuncInfo) []ast.Expr {
+	namespace := fn.Name.PackagePath
+	if namespace == "" {
+		namespace = fn.Name.PackageName
+	}
+	if receiver := fn.Name.Receiver; receiver != "" {
+		if fn.Name.PointerReceiver {
+			receiver = "(*" + receiver + ")"
+		}
+		namespace += "." + receiver
+	}
+
+	file := path.Join(fn.Name.PackagePath, filepath.Base(fn.Position.Filename))
+
+	semconv := func(fn string, value ast.Expr) ast.Expr {
+		return &ast.CallExpr{
+			Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelSemconv"}, Sel: &ast.Ident{Name: fn}},
+			Args: []ast.Expr{value},
+		}
+	}
+	return []ast.Expr{
+		semconv("CodeFunction", &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(fn.Name.Function)}),
+		semconv("CodeNamespace", &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(namespace)}),
+		semconv("CodeFilepath", &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(file)}),
+		semconv("CodeLineNumber", &ast.BasicLit{Kind: token.INT, Value: strconv.Itoa(fn.Position.Line)}),
+	}
+}
+
+// attribute makes attribute of variable of basic kind, or nil if it is not recorded
+func (s *OpenTelemetry) attribute(v processor.Var) ast.Expr {
+	if v.Name == "" || v.Name == "_" || v.Type == nil {
+		return nil
+	}
+	if len(s.AttributeTypes) > 0 && !slices.Contains(s.AttributeTypes, types.ExprString(v.Expr)) {
+		return nil
+	}
+	for _, q := range s.AttributeDenyNames {
+		if strings.Contains(strings.ToLower(v.Name), strings.ToLower(q)) {
+			return nil
+		}
+	}
+	return attributeExpr(v.Name, &ast.Ident{Name: v.Name}, v.Type)
+}
+
+// attributeExpr makes attribute.<Kind>(key, value) for value of basic kind, converting value if its type differs, or nil for other kinds
+func attributeExpr(key string, value ast.Expr, t types.Type) ast.Expr {
+	basic, ok := t.Underlying().(*types.Basic)
+	if !ok {
+		return nil
+	}
+
+	var fn string
+	var target *types.Basic
+	switch {
+	case basic.Info()&types.IsString != 0:
+		fn, target = "String", types.Typ[types.String]
+	case basic.Info()&types.IsBoolean != 0:
+		fn, target = "Bool", types.Typ[types.Bool]
+	case basic.Kind() == types.Int:
+		fn, target = "Int", types.Typ[types.Int]
+	case basic.Info()&types.IsInteger != 0:
+		fn, target = "Int64", types.Typ[types.Int64]
+	case basic.Info()&types.IsFloat != 0:
+		fn, target = "Float64", types.Typ[types.Float64]
+	default:
+		return nil
+	}
+
+	if !types.Identical(t, target) {
+		value = &ast.CallExpr{Fun: &ast.Ident{Name: target.Name()}, Args: []ast.Expr{value}}
+	}
+
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "otelAttribute"}, Sel: &ast.Ident{Name: fn}},
+		Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(key)}, value},
 	}
 }
 
-func (s *OpenTelemetry) exprFuncSetSpanError(errorName string) ast.Expr {
+func (s *OpenTelemetry) exprFuncSetSpanError(spanVar string, errorName string) ast.Expr {
 	return &ast.FuncLit{
 		Type: &ast.FuncType{},
 		Body: &ast.BlockStmt{List: []ast.Stmt{
@@ -70,14 +424,14 @@ func (s *OpenTelemetry) exprFuncSetSpanError(errorName string) ast.Expr {
 				Cond: &ast.BinaryExpr{X: &ast.Ident{Name: errorName}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
 				Body: &ast.BlockStmt{List: []ast.Stmt{
 					&ast.ExprStmt{X: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "SetStatus"}},
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "SetStatus"}},
 						Args: []ast.Expr{
 							&ast.SelectorExpr{X: &ast.Ident{Name: "otelCodes"}, Sel: &ast.Ident{Name: "Error"}},
-							&ast.BasicLit{Kind: token.STRING, Value: `"` + s.ErrorStatusDescription + `"`},
+							&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s.ErrorStatusDescription)},
 						},
 					}},
 					&ast.ExprStmt{X: &ast.CallExpr{
-						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "span"}, Sel: &ast.Ident{Name: "RecordError"}},
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: spanVar}, Sel: &ast.Ident{Name: "RecordError"}},
 						Args: []ast.Expr{
 							&ast.Ident{Name: errorName},
 						},
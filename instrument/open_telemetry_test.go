@@ -3,13 +3,17 @@ package instrument_test
 import (
 	"bytes"
 	_ "embed"
+	"go/ast"
 	"go/printer"
 	"go/token"
 	"go/types"
 	"maps"
+	"regexp"
+	"strings"
 	"testing"
 
 	"github.com/nikolaydubina/go-instrument/instrument"
+	"github.com/nikolaydubina/go-instrument/processor"
 )
 
 //go:embed testdata/open_telemetry_error.go
@@ -18,6 +22,21 @@ var expOpenTelemetryError string
 //go:embed testdata/open_telemetry.go
 var expOpenTelemetry string
 
+//go:embed testdata/open_telemetry_attributes.go
+var expOpenTelemetryAttributes string
+
+//go:embed testdata/open_telemetry_result_attributes.go
+var expOpenTelemetryResultAttributes string
+
+//go:embed testdata/open_telemetry_panic.go
+var expOpenTelemetryPanic string
+
+//go:embed testdata/open_telemetry_code_attributes.go
+var expOpenTelemetryCodeAttributes string
+
+//go:embed testdata/open_telemetry_tracer_var.go
+var expOpenTelemetryTracerVar string
+
 func TestOpenTelemetry_Error(t *testing.T) {
 	p := instrument.OpenTelemetry{
 		TracerName:             "app",
@@ -71,6 +90,270 @@ func TestOpenTelemetry(t *testing.T) {
 	}
 }
 
+func TestOpenTelemetry_ParamAttributes(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName:         "app",
+		ParamAttributes:    true,
+		AttributeDenyNames: instrument.DefaultAttributeDenyNames,
+	}
+	level := types.NewNamed(types.NewTypeName(0, nil, "Level", nil), types.Typ[types.Uint8], nil)
+	c := p.FuncPrefixStatements(processor.FuncInfo{
+		SpanName:    "myClass.MyFunction",
+		ContextName: "ctx",
+		Params: []processor.Var{
+			{Name: "ctx", Expr: &ast.SelectorExpr{X: &ast.Ident{Name: "context"}, Sel: &ast.Ident{Name: "Context"}}},
+			{Name: "id", Expr: &ast.Ident{Name: "string"}, Type: types.Typ[types.String]},
+			{Name: "level", Expr: &ast.Ident{Name: "Level"}, Type: level},
+			{Name: "authToken", Expr: &ast.Ident{Name: "string"}, Type: types.Typ[types.String]},
+			{Name: "_", Expr: &ast.Ident{Name: "string"}, Type: types.Typ[types.String]},
+			{Name: "tags", Expr: &ast.ArrayType{Elt: &ast.Ident{Name: "string"}}, Type: types.NewSlice(types.Typ[types.String])},
+		},
+	})
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryAttributes {
+		t.Error(s)
+	}
+
+	expImportPaths := map[string]bool{
+		"go.opentelemetry.io/otel ":                        true,
+		"go.opentelemetry.io/otel/attribute otelAttribute": true,
+		"go.opentelemetry.io/otel/trace otelTrace":         true,
+	}
+	importPaths := importPathsFromImports(p.Imports())
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestOpenTelemetry_ResultAttributes(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName:       "app",
+		ResultAttributes: true,
+	}
+	c := p.FuncPrefixStatements(processor.FuncInfo{
+		SpanName:    "myClass.MyFunction",
+		ContextName: "ctx",
+		Results: []processor.Var{
+			{Name: "count", Expr: &ast.Ident{Name: "int"}, Type: types.Typ[types.Int]},
+			{Name: "found", Expr: &ast.Ident{Name: "bool"}, Type: types.Typ[types.Bool]},
+			{Expr: &ast.Ident{Name: "string"}, Type: types.Typ[types.String]},
+		},
+	})
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryResultAttributes {
+		t.Error(s)
+	}
+
+	expImportPaths := map[string]bool{
+		"go.opentelemetry.io/otel ":                        true,
+		"go.opentelemetry.io/otel/attribute otelAttribute": true,
+	}
+	importPaths := importPathsFromImports(p.Imports())
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestOpenTelemetry_RecordPanic(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName:  "app",
+		RecordPanic: true,
+	}
+	c := p.FuncPrefixStatements(processor.FuncInfo{SpanName: "myClass.MyFunction", ContextName: "ctx"})
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryPanic {
+		t.Error(s)
+	}
+
+	expImportPaths := map[string]bool{
+		"fmt otelFmt":                              true,
+		"go.opentelemetry.io/otel ":                true,
+		"go.opentelemetry.io/otel/codes otelCodes": true,
+		"go.opentelemetry.io/otel/trace otelTrace": true,
+	}
+	importPaths := importPathsFromImports(p.Imports())
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestOpenTelemetry_CodeAttributes(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName:      "app",
+		CodeAttributes:  true,
+		ParamAttributes: true,
+	}
+	c := p.FuncPrefixStatements(processor.FuncInfo{
+		Name: processor.FuncName{
+			PackagePath:     "github.com/org/svc/store",
+			PackageName:     "store",
+			File:            "/home/user/svc/store/my_class.go",
+			Receiver:        "myClass",
+			PointerReceiver: true,
+			Function:        "MyFunction",
+		},
+		Position:    token.Position{Filename: "/home/user/svc/store/my_class.go", Line: 42},
+		SpanName:    "myClass.MyFunction",
+		ContextName: "ctx",
+		Params:      []processor.Var{{Name: "id", Expr: &ast.Ident{Name: "string"}, Type: types.Typ[types.String]}},
+	})
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryCodeAttributes {
+		t.Error(s)
+	}
+
+	expImportPaths := map[string]bool{
+		"go.opentelemetry.io/otel ":                            true,
+		"go.opentelemetry.io/otel/attribute otelAttribute":     true,
+		"go.opentelemetry.io/otel/semconv/v1.26.0 otelSemconv": true,
+		"go.opentelemetry.io/otel/trace otelTrace":             true,
+	}
+	importPaths := importPathsFromImports(p.Imports())
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestOpenTelemetry_TracerVar(t *testing.T) {
+	p := instrument.OpenTelemetry{
+		TracerName: "app",
+		TracerVar:  "tracer",
+	}
+	c := p.PrefixStatements("myClass.MyFunction", "ctx", false, "err")
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expOpenTelemetryTracerVar {
+		t.Error(s)
+	}
+
+	if importPaths := importPathsFromImports(p.Imports()); len(importPaths) != 0 {
+		t.Error(importPaths)
+	}
+
+	decls := p.PackageDecls()
+	if len(decls) != 1 || decls[0].Name != "tracer" {
+		t.Fatal(decls)
+	}
+
+	out.Reset()
+	printer.Fprint(&out, token.NewFileSet(), decls[0].Decl)
+
+	if s := out.String(); s != `var tracer = otel.Tracer("app")` {
+		t.Error(s)
+	}
+	if importPaths := importPathsFromImports(decls[0].Imports); !maps.Equal(map[string]bool{"go.opentelemetry.io/otel ": true}, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestOpenTelemetry_SpanKind(t *testing.T) {
+	request := &ast.StarExpr{X: &ast.SelectorExpr{X: &ast.Ident{Name: "http"}, Sel: &ast.Ident{Name: "Request"}}}
+	responseWriter := &ast.SelectorExpr{X: &ast.Ident{Name: "http"}, Sel: &ast.Ident{Name: "ResponseWriter"}}
+
+	tests := []struct {
+		name string
+		fn   processor.FuncInfo
+		exp  string
+	}{
+		{
+			name: "http handler",
+			fn:   processor.FuncInfo{Params: []processor.Var{{Name: "w", Expr: responseWriter}, {Name: "r", Expr: request}}},
+			exp:  `otelTrace.WithSpanKind(otelTrace.SpanKindServer)`,
+		},
+		{
+			name: "method of server type",
+			fn:   processor.FuncInfo{Name: processor.FuncName{Receiver: "CatHandler", Function: "Get"}, Receiver: &processor.Var{Name: "s"}},
+			exp:  `otelTrace.WithSpanKind(otelTrace.SpanKindServer)`,
+		},
+		{
+			name: "method of client type",
+			fn:   processor.FuncInfo{Name: processor.FuncName{Receiver: "CatClient[K]", Function: "Get"}, Receiver: &processor.Var{Name: "c"}},
+			exp:  `otelTrace.WithSpanKind(otelTrace.SpanKindClient)`,
+		},
+		{
+			name: "anonymous function in method of client type",
+			fn:   processor.FuncInfo{Name: processor.FuncName{Receiver: "CatClient", Function: "Get.func1"}},
+		},
+		{
+			name: "function",
+			fn:   processor.FuncInfo{Params: []processor.Var{{Name: "r", Expr: request}}},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := instrument.OpenTelemetry{
+				TracerName:  "app",
+				SpanKind:    true,
+				ServerTypes: []*regexp.Regexp{regexp.MustCompile(`Handler$`)},
+				ClientTypes: []*regexp.Regexp{regexp.MustCompile(`Client$`)},
+			}
+			tc.fn.SpanName, tc.fn.ContextName = "myClass.MyFunction", "ctx"
+			c := p.FuncPrefixStatements(tc.fn)
+
+			var out bytes.Buffer
+			printer.Fprint(&out, token.NewFileSet(), c)
+
+			if s := out.String(); (tc.exp == "") == strings.Contains(s, "WithSpanKind") || !strings.Contains(s, tc.exp) {
+				t.Error(s)
+			}
+		})
+	}
+}
+
+func TestOpenTelemetry_LinkGoroutines(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   processor.FuncInfo
+		exp  string
+	}{
+		{
+			name: "goroutine",
+			fn:   processor.FuncInfo{Goroutine: true},
+			exp:  `ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction", otelTrace.WithNewRoot(), otelTrace.WithLinks(otelTrace.LinkFromContext(ctx)))`,
+		},
+		{
+			name: "function",
+			fn:   processor.FuncInfo{},
+			exp:  `ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction")`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			p := instrument.OpenTelemetry{TracerName: "app", LinkGoroutines: true}
+			tc.fn.SpanName, tc.fn.ContextName = "myClass.MyFunction", "ctx"
+			c := p.FuncPrefixStatements(tc.fn)
+
+			var out bytes.Buffer
+			printer.Fprint(&out, token.NewFileSet(), c)
+
+			if s := out.String(); !strings.Contains(s, tc.exp+"\n") {
+				t.Error(s)
+			}
+			if _, ok := importPathsFromImports(p.Imports())["go.opentelemetry.io/otel/trace otelTrace"]; ok != tc.fn.Goroutine {
+				t.Error(p.Imports())
+			}
+		})
+	}
+}
+
 func importPathsFromImports(imports []*types.Package) map[string]bool {
 	importPaths := make(map[string]bool, len(imports))
 	for _, pkg := range imports {
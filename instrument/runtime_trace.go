@@ -0,0 +1,95 @@
+package instrument
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+// RuntimeTrace instruments functions with standard runtime/trace tasks or regions, that are visible in go tool trace
+type RuntimeTrace struct {
+	Regions bool // if true, use regions instead of tasks
+
+	hasInserts bool
+}
+
+func (s *RuntimeTrace) Imports() []*types.Package {
+	if !s.hasInserts {
+		return nil
+	}
+	return []*types.Package{
+		types.NewPackage("runtime/trace", "rtTrace"),
+	}
+}
+
+func (s *RuntimeTrace) PrefixStatements(spanName string, contextName string, hasError bool, errorName string) []ast.Stmt {
+	return s.prefixStatements(spanName, contextName, "task", &ast.Ident{Name: contextName}, hasError, errorName)
+}
+
+func (s *RuntimeTrace) FuncPrefixStatements(fn processor.FuncInfo) []ast.Stmt {
+	return s.prefixStatements(fn.SpanName, fn.ContextName, fn.UnusedName("task"), fn.ParentContext(), fn.HasError, fn.ErrorName)
+}
+
+// prefixStatements starts task or region from parent context, regions do not define context so error is logged to parent context
+func (s *RuntimeTrace) prefixStatements(spanName string, contextName string, taskName string, parentContext ast.Expr, hasError bool, errorName string) []ast.Stmt {
+	s.hasInserts = true
+
+	var stmts []ast.Stmt
+	if s.Regions {
+		stmts = []ast.Stmt{
+			&ast.DeferStmt{Call: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{X: s.exprCall("StartRegion", parentContext, spanName), Sel: &ast.Ident{Name: "End"}},
+			}},
+		}
+	} else {
+		stmts = []ast.Stmt{
+			&ast.AssignStmt{
+				Tok: token.DEFINE,
+				Lhs: []ast.Expr{&ast.Ident{Name: contextName}, &ast.Ident{Name: taskName}},
+				Rhs: []ast.Expr{s.exprCall("NewTask", parentContext, spanName)},
+			},
+			&ast.DeferStmt{Call: &ast.CallExpr{
+				Fun: &ast.SelectorExpr{X: &ast.Ident{Name: taskName}, Sel: &ast.Ident{Name: "End"}},
+			}},
+		}
+	}
+	if hasError {
+		logContext := ast.Expr(&ast.Ident{Name: contextName})
+		if s.Regions {
+			logContext = parentContext
+		}
+		stmts = append(stmts, &ast.DeferStmt{Call: &ast.CallExpr{Fun: s.exprFuncLogError(logContext, errorName)}})
+	}
+	return stmts
+}
+
+func (s *RuntimeTrace) exprCall(name string, parentContext ast.Expr, spanName string) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun:  &ast.SelectorExpr{X: &ast.Ident{Name: "rtTrace"}, Sel: &ast.Ident{Name: name}},
+		Args: []ast.Expr{parentContext, &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(spanName)}},
+	}
+}
+
+func (s *RuntimeTrace) exprFuncLogError(logContext ast.Expr, errorName string) ast.Expr {
+	return &ast.FuncLit{
+		Type: &ast.FuncType{},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.IfStmt{
+				Cond: &ast.BinaryExpr{X: &ast.Ident{Name: errorName}, Op: token.NEQ, Y: &ast.Ident{Name: "nil"}},
+				Body: &ast.BlockStmt{List: []ast.Stmt{
+					&ast.ExprStmt{X: &ast.CallExpr{
+						Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "rtTrace"}, Sel: &ast.Ident{Name: "Log"}},
+						Args: []ast.Expr{
+							logContext,
+							&ast.BasicLit{Kind: token.STRING, Value: `"error"`},
+							&ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: errorName}, Sel: &ast.Ident{Name: "Error"}}},
+						},
+					}},
+				}},
+			},
+		}},
+	}
+}
@@ -0,0 +1,74 @@
+package instrument_test
+
+import (
+	"bytes"
+	_ "embed"
+	"go/ast"
+	"go/printer"
+	"go/token"
+	"maps"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+//go:embed testdata/runtime_trace_error.go
+var expRuntimeTraceError string
+
+//go:embed testdata/runtime_trace_region.go
+var expRuntimeTraceRegion string
+
+//go:embed testdata/runtime_trace_region_request.go
+var expRuntimeTraceRegionRequest string
+
+func TestRuntimeTrace_Error(t *testing.T) {
+	p := instrument.RuntimeTrace{}
+	c := p.PrefixStatements("myClass.MyFunction", "ctx", true, "err")
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expRuntimeTraceError {
+		t.Error(s)
+	}
+
+	expImportPaths := map[string]bool{
+		"runtime/trace rtTrace": true,
+	}
+	importPaths := importPathsFromImports(p.Imports())
+
+	if !maps.Equal(expImportPaths, importPaths) {
+		t.Error(importPaths)
+	}
+}
+
+func TestRuntimeTrace_Region(t *testing.T) {
+	p := instrument.RuntimeTrace{Regions: true}
+	c := p.PrefixStatements("myClass.MyFunction", "ctx", false, "err")
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expRuntimeTraceRegion {
+		t.Error(s)
+	}
+}
+
+func TestRuntimeTrace_RegionContextExpr(t *testing.T) {
+	p := instrument.RuntimeTrace{Regions: true}
+	c := p.FuncPrefixStatements(processor.FuncInfo{
+		SpanName:    "myClass.MyFunction",
+		ContextName: "ctx",
+		ContextExpr: &ast.CallExpr{Fun: &ast.SelectorExpr{X: &ast.Ident{Name: "r"}, Sel: &ast.Ident{Name: "Context"}}},
+		HasError:    true,
+		ErrorName:   "err",
+	})
+
+	var out bytes.Buffer
+	printer.Fprint(&out, token.NewFileSet(), c)
+
+	if s := out.String(); s != expRuntimeTraceRegionRequest {
+		t.Error(s)
+	}
+}
@@ -0,0 +1,2 @@
+span, ctx := ddTracer.StartSpanFromContext(ctx, "myClass.MyFunction", ddTracer.ServiceName("app"))
+defer span.Finish()
\ No newline at end of file
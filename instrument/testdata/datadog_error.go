@@ -0,0 +1,8 @@
+span, ctx := ddTracer.StartSpanFromContext(ctx, "myClass.MyFunction", ddTracer.ServiceName("app"))
+defer func() {
+	if err != nil {
+		span.Finish(ddTracer.WithError(err))
+	} else {
+		span.Finish()
+	}
+}()
\ No newline at end of file
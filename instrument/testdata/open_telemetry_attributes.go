@@ -0,0 +1,2 @@
+ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction", otelTrace.WithAttributes(otelAttribute.String("id", id), otelAttribute.Int64("level", int64(level))))
+defer span.End()
\ No newline at end of file
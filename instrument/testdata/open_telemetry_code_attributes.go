@@ -0,0 +1,2 @@
+ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction", otelTrace.WithAttributes(otelSemconv.CodeFunction("MyFunction"), otelSemconv.CodeNamespace("github.com/org/svc/store.(*myClass)"), otelSemconv.CodeFilepath("github.com/org/svc/store/my_class.go"), otelSemconv.CodeLineNumber(42), otelAttribute.String("id", id)))
+defer span.End()
\ No newline at end of file
@@ -0,0 +1,5 @@
+ctx, span := otel.Tracer("app").Start(ctx, "myClass.MyFunction")
+defer span.End()
+defer func() {
+	span.SetAttributes(otelAttribute.Int("count", count), otelAttribute.Bool("found", found))
+}()
\ No newline at end of file
@@ -0,0 +1,2 @@
+ctx, span := tracer.Start(ctx, "myClass.MyFunction")
+defer span.End()
\ No newline at end of file
@@ -0,0 +1,7 @@
+ctx, task := rtTrace.NewTask(ctx, "myClass.MyFunction")
+defer task.End()
+defer func() {
+	if err != nil {
+		rtTrace.Log(ctx, "error", err.Error())
+	}
+}()
\ No newline at end of file
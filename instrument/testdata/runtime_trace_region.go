@@ -0,0 +1 @@
+defer rtTrace.StartRegion(ctx, "myClass.MyFunction").End()
\ No newline at end of file
@@ -0,0 +1,6 @@
+defer rtTrace.StartRegion(r.Context(), "myClass.MyFunction").End()
+defer func() {
+	if err != nil {
+		rtTrace.Log(r.Context(), "error", err.Error())
+	}
+}()
\ No newline at end of file
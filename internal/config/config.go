@@ -0,0 +1,89 @@
+// Package config has options of instrumentation shared by go-instrument and analyzer,
+// their flags, and config files that set them.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileNames are discovered by walking up from target directory
+var FileNames = []string{".go-instrument.yaml", ".go-instrument.yml", ".go-instrument.json"}
+
+// ExcludedFlags select files and mode of single run, thus can not be set in config
+var ExcludedFlags = []string{"filename", "config", "w", "d", "l", "check", "remove"}
+
+// Find returns path of closest config file in directory or its parents, or empty if none
+func Find(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for {
+		for _, name := range FileNames {
+			if fileName := filepath.Join(dir, name); isFile(fileName) {
+				return fileName, nil
+			}
+		}
+		if filepath.Dir(dir) == dir {
+			return "", nil
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func isFile(fileName string) bool {
+	info, err := os.Stat(fileName)
+	return err == nil && !info.IsDir()
+}
+
+// Apply sets flags from config file. Keys of config are flag names, lists are used for repeated flags.
+// Flags that are set in command line take precedence over config.
+func Apply(flags *flag.FlagSet, fileName string) error {
+	b, err := os.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var config map[string]any
+	if filepath.Ext(fileName) == ".json" {
+		err = json.Unmarshal(b, &config)
+	} else {
+		err = yaml.Unmarshal(b, &config)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", fileName, err)
+	}
+
+	isSet := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) { isSet[f.Name] = true })
+
+	var errs []error
+	for name, value := range config {
+		if flags.Lookup(name) == nil || slices.Contains(ExcludedFlags, name) {
+			errs = append(errs, fmt.Errorf("%s: unknown key %q", fileName, name))
+			continue
+		}
+		if isSet[name] {
+			continue
+		}
+
+		values, ok := value.([]any)
+		if !ok {
+			values = []any{value}
+		}
+		for _, v := range values {
+			if err := flags.Set(name, fmt.Sprint(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s: %w", fileName, name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
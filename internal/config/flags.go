@@ -0,0 +1,81 @@
+package config
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+// regexpsFlag is repeated flag of regular expressions
+type regexpsFlag []*regexp.Regexp
+
+func (s *regexpsFlag) String() string {
+	var vs []string
+	for _, q := range *s {
+		vs = append(vs, q.String())
+	}
+	return strings.Join(vs, ",")
+}
+
+func (s *regexpsFlag) Set(v string) error {
+	r, err := regexp.Compile(v)
+	if err != nil {
+		return err
+	}
+	*s = append(*s, r)
+	return nil
+}
+
+// stringsFlag is repeated flag of strings
+type stringsFlag []string
+
+func (s *stringsFlag) String() string { return strings.Join(*s, ",") }
+
+func (s *stringsFlag) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// contextSourcesFlag is repeated flag of context sources in form TYPE=CONTEXT or TYPE=CONTEXT;WRITEBACK
+type contextSourcesFlag struct {
+	sources  *[]processor.ContextSource
+	receiver bool
+}
+
+func (s contextSourcesFlag) String() string {
+	if s.sources == nil {
+		return ""
+	}
+	var vs []string
+	for _, q := range *s.sources {
+		if q.Receiver != s.receiver {
+			continue
+		}
+		v := q.Type.String() + "=" + q.Context
+		if q.Writeback != "" {
+			v += ";" + q.Writeback
+		}
+		vs = append(vs, v)
+	}
+	return strings.Join(vs, ",")
+}
+
+func (s contextSourcesFlag) Set(v string) error {
+	typ, expr, ok := strings.Cut(v, "=")
+	if !ok {
+		return errors.New("expected TYPE=CONTEXT or TYPE=CONTEXT;WRITEBACK")
+	}
+	r, err := regexp.Compile(typ)
+	if err != nil {
+		return err
+	}
+	source := processor.ContextSource{Type: r, Receiver: s.receiver}
+	source.Context, source.Writeback, _ = strings.Cut(expr, ";")
+	if err := source.Validate(); err != nil {
+		return err
+	}
+	*s.sources = append(*s.sources, source)
+	return nil
+}
@@ -0,0 +1,190 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"go/parser"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nikolaydubina/go-instrument/instrument"
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+// Options of instrumentation, that can be set by flags and config files
+type Options struct {
+	App                 string
+	Instrumenter        string
+	SkipGenerated       bool
+	PreserveLineNumbers bool
+	Types               bool
+	NameResults         bool
+	ReceiverTypeParams  bool
+	AnonymousFuncLine   bool
+	SpanName            string
+	SpanNameTemplate    string
+	ParamAttributes     bool
+	ResultAttributes    bool
+	RecordPanic         bool
+	CodeAttributes      bool
+	TracerVar           string
+	SpanKind            bool
+	ServerTypes         []*regexp.Regexp
+	ClientTypes         []*regexp.Regexp // Client$ if empty
+	AttributeTypes      []string
+	AttributeDeny       []string
+	ContextSources      []processor.ContextSource // in addition to processor.DefaultContextSources
+	RootFunctions       []*regexp.Regexp
+	Goroutines          string
+	RootContext         string
+	RootContextImport   string
+	Functions           processor.Filter
+	Packages            processor.Filter
+	Files               processor.Filter
+
+	ErrorStatusDescription      string
+	ContextPackage, ContextType string
+	ErrorType                   string
+}
+
+// RegisterFlags defines flags of options in flag set
+func (opts *Options) RegisterFlags(flags *flag.FlagSet) {
+	flags.StringVar(&opts.App, "app", "app", "name of application")
+	flags.StringVar(&opts.Instrumenter, "instrumenter", "otel", "instrumentation to insert: otel, datadog, runtime-trace, runtime-trace-region")
+	flags.BoolVar(&opts.SkipGenerated, "skip-generated", false, "skip generated files")
+	flags.BoolVar(&opts.PreserveLineNumbers, "preserve-line-numbers", true, "use compiler directives to preserve line numbers as if no instrumentation was applied (e.g. keep same line numbers in panic as if no instrumentation)")
+	flags.BoolVar(&opts.Types, "types", false, "load type information of package to detect context and error by type (aliased imports, type aliases, interfaces embedding context, concrete error types)")
+	flags.BoolVar(&opts.NameResults, "name-results", false, "name unnamed results of functions returning error, so that returned error is recorded")
+	flags.StringVar(&opts.SpanName, "span-name", "short", "span naming: short (Cat.Name), package (store.Cat.Name), full (github.com/org/svc/store.(*Cat).Name)")
+	flags.StringVar(&opts.SpanNameTemplate, "span-name-template", "", "text/template of span name with fields of processor.FuncName, e.g. {{.PackageName}}/{{.Function}}, overrides -span-name")
+	flags.BoolVar(&opts.ReceiverTypeParams, "receiver-type-params", false, "include type parameters of generic receiver in span name, e.g. Cache[K,V].Get instead of Cache.Get")
+	flags.BoolVar(&opts.AnonymousFuncLine, "anonymous-func-line", false, "include line of anonymous function in span name, e.g. Handle.func1:42")
+	flags.BoolVar(&opts.ParamAttributes, "param-attributes", false, "record parameters of basic kinds (strings, integers, floats, bools, and named types over them) as span attributes, otel only")
+	flags.BoolVar(&opts.ResultAttributes, "result-attributes", false, "record named results of basic kinds as span attributes when function returns, otel only")
+	flags.StringVar(&opts.TracerVar, "tracer-var", "", "package level variable of tracer that is declared once per package or reused if exists, e.g. tracer, otel only, tracer is looked up on every call if empty")
+	flags.BoolVar(&opts.SpanKind, "span-kind", false, "set span kind: server for http handlers, gRPC server methods (with -types), and -server-type methods, client for -client-type methods, otel only")
+	flags.Var((*regexpsFlag)(&opts.ServerTypes), "server-type", "methods of receiver with type name matching regular expression are servers for -span-kind (repeated)")
+	flags.Var((*regexpsFlag)(&opts.ClientTypes), "client-type", "methods of receiver with type name matching regular expression are clients for -span-kind, Client$ if not set (repeated)")
+	flags.BoolVar(&opts.CodeAttributes, "code-attributes", false, "record code.function, code.namespace, code.filepath, and code.lineno semantic convention attributes, otel only")
+	flags.BoolVar(&opts.RecordPanic, "record-panic", false, "record panic with stack trace and error status on span, and panic again, otel only")
+	flags.Var((*stringsFlag)(&opts.AttributeTypes), "attribute-type", "record only parameters and results of type as written in source, e.g. string or UserID (repeated)")
+	flags.Var((*stringsFlag)(&opts.AttributeDeny), "attribute-deny", "do not record parameters and results with name containing this, case insensitive, in addition to "+strings.Join(instrument.DefaultAttributeDenyNames, ", ")+" (repeated)")
+	flags.Var(contextSourcesFlag{sources: &opts.ContextSources}, "context-source", "extract context from parameter of type matching regular expression in functions without context parameter, in addition to *http.Request, as TYPE=CONTEXT or TYPE=CONTEXT;WRITEBACK with text/template of {{.Name}} of parameter and {{.Context}} of derived context, e.g. '^\\*gin\\.Context$={{.Name}}.Request.Context();{{.Name}}.Request = {{.Name}}.Request.WithContext({{.Context}})' (repeated)")
+	flags.Var(contextSourcesFlag{sources: &opts.ContextSources, receiver: true}, "context-receiver", "extract context from receiver of type matching regular expression in methods without context parameter, as -context-source, e.g. '^\\*Server$={{.Name}}.ctx' (repeated)")
+	flags.StringVar(&opts.Goroutines, "goroutines", "", "instrument function literals without context launched by go statement, with span from captured context of enclosing function: child (child span), link (new root span linked to enclosing span, otel only), not instrumented if empty")
+	flags.Var((*regexpsFlag)(&opts.RootFunctions), "root", "instrument functions without context with span name matching regular expression, starting root span from -root-context (repeated)")
+	flags.StringVar(&opts.RootContext, "root-context", "", "expression of context of root spans of -root functions, e.g. appctx.Root(), context.Background() if empty")
+	flags.StringVar(&opts.RootContextImport, "root-context-import", "", "import path of package that -root-context refers to, e.g. github.com/org/svc/appctx")
+	flags.Var((*regexpsFlag)(&opts.Functions.Include), "include", "instrument only functions with span name matching regular expression (repeated)")
+	flags.Var((*regexpsFlag)(&opts.Functions.Exclude), "exclude", "do not instrument functions with span name matching regular expression (repeated)")
+	flags.Var((*regexpsFlag)(&opts.Packages.Include), "include-package", "instrument only packages with import path matching regular expression (repeated)")
+	flags.Var((*regexpsFlag)(&opts.Packages.Exclude), "exclude-package", "do not instrument packages with import path matching regular expression (repeated)")
+	flags.Var((*regexpsFlag)(&opts.Files.Include), "include-file", "instrument only files with path matching regular expression (repeated)")
+	flags.Var((*regexpsFlag)(&opts.Files.Exclude), "exclude-file", "do not instrument files with path matching regular expression (repeated)")
+	flags.StringVar(&opts.ErrorStatusDescription, "error-status-description", "error", "description of span status when function returns error")
+	flags.StringVar(&opts.ContextPackage, "context-package", "context", "package of context type")
+	flags.StringVar(&opts.ContextType, "context-type", "Context", "name of context type")
+	flags.StringVar(&opts.ErrorType, "error-type", "error", "name of error type")
+}
+
+// Validate checks options that are not checked by flags
+func (opts Options) Validate() error {
+	if _, err := opts.NewInstrumenter(); err != nil {
+		return err
+	}
+	if _, err := opts.NewSpanName(); err != nil {
+		return err
+	}
+	if !slices.Contains([]string{"", "child", "link"}, opts.Goroutines) {
+		return fmt.Errorf("unknown goroutines %q", opts.Goroutines)
+	}
+	if opts.RootContext != "" {
+		if _, err := parser.ParseExpr(opts.RootContext); err != nil {
+			return fmt.Errorf("root context: %w", err)
+		}
+	}
+	return nil
+}
+
+// NewInstrumenter makes new instrumenter for every file, since instrumenter tracks imports of file
+func (opts Options) NewInstrumenter() (processor.FuncInstrumenter, error) {
+	clientTypes := opts.ClientTypes
+	if len(clientTypes) == 0 {
+		clientTypes = []*regexp.Regexp{regexp.MustCompile(`Client$`)}
+	}
+	switch opts.Instrumenter {
+	case "otel":
+		return &instrument.OpenTelemetry{
+			TracerName:             opts.App,
+			ErrorStatusDescription: opts.ErrorStatusDescription,
+			ParamAttributes:        opts.ParamAttributes,
+			ResultAttributes:       opts.ResultAttributes,
+			RecordPanic:            opts.RecordPanic,
+			CodeAttributes:         opts.CodeAttributes,
+			TracerVar:              opts.TracerVar,
+			SpanKind:               opts.SpanKind,
+			ServerTypes:            opts.ServerTypes,
+			ClientTypes:            clientTypes,
+			AttributeTypes:         opts.AttributeTypes,
+			AttributeDenyNames:     append(slices.Clone(instrument.DefaultAttributeDenyNames), opts.AttributeDeny...),
+			LinkGoroutines:         opts.Goroutines == "link",
+		}, nil
+	case "datadog":
+		return &instrument.Datadog{ServiceName: opts.App}, nil
+	case "runtime-trace":
+		return &instrument.RuntimeTrace{}, nil
+	case "runtime-trace-region":
+		return &instrument.RuntimeTrace{Regions: true}, nil
+	default:
+		return nil, fmt.Errorf("unknown instrumenter %q", opts.Instrumenter)
+	}
+}
+
+func (opts Options) NewSpanName() (func(fn processor.FuncName) string, error) {
+	if opts.SpanNameTemplate != "" {
+		return processor.TemplateSpanName(opts.SpanNameTemplate)
+	}
+	switch opts.SpanName {
+	case "short":
+		return processor.BasicSpanName, nil
+	case "package":
+		return processor.PackageSpanName, nil
+	case "full":
+		return processor.FullSpanName, nil
+	default:
+		return nil, fmt.Errorf("unknown span name %q", opts.SpanName)
+	}
+}
+
+// NewProcessor makes processor with new instrumenter for single file.
+// Package of file is set by caller.
+func (opts Options) NewProcessor() (*processor.Processor, error) {
+	instrumenter, err := opts.NewInstrumenter()
+	if err != nil {
+		return nil, err
+	}
+	spanName, err := opts.NewSpanName()
+	if err != nil {
+		return nil, err
+	}
+	return &processor.Processor{
+		FuncInstrumenter:    instrumenter,
+		PreserveLineNumbers: opts.PreserveLineNumbers,
+		SpanName:            spanName,
+		ReceiverTypeParams:  opts.ReceiverTypeParams,
+		AnonymousFuncLine:   opts.AnonymousFuncLine,
+		ContextPackage:      opts.ContextPackage,
+		ContextType:         opts.ContextType,
+		ErrorType:           opts.ErrorType,
+		NameResults:         opts.NameResults,
+		ContextSources:      append(slices.Clone(opts.ContextSources), processor.DefaultContextSources...),
+		Goroutines:          opts.Goroutines != "",
+		RootFunctions:       opts.RootFunctions,
+		RootContext:         opts.RootContext,
+		RootContextImport:   opts.RootContextImport,
+		Functions:           opts.Functions,
+		Packages:            opts.Packages,
+		Files:               opts.Files,
+	}, nil
+}
@@ -0,0 +1,195 @@
+// Copyright 2022 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package diff makes unified diff of two texts.
+// It is adapted from Go internal/diff, and uses anchored diff, which matches lines that are unique in both texts.
+// This is not minimal diff, but it runs in O(n log n) time, and is readable for typical source changes.
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// context is number of unchanged lines around changes
+const context = 3
+
+type pair struct{ x, y int }
+
+// Diff returns unified diff of old and new, or nil if they are equal
+func Diff(oldName string, old []byte, newName string, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	x, y := lines(old), lines(new)
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "diff %s %s\n", oldName, newName)
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+
+	var (
+		done  pair     // x[:done.x] and y[:done.y] are already printed
+		chunk pair     // start of current chunk
+		count pair     // number of lines from each side in current chunk
+		ctext []string // lines of current chunk
+	)
+
+	for _, m := range anchors(x, y) {
+		if m.x < done.x {
+			continue
+		}
+
+		// expand matching lines in both directions
+		start := m
+		for start.x > done.x && start.y > done.y && x[start.x-1] == y[start.y-1] {
+			start.x--
+			start.y--
+		}
+		end := m
+		for end.x < len(x) && end.y < len(y) && x[end.x] == y[end.y] {
+			end.x++
+			end.y++
+		}
+
+		// mismatched lines before start
+		for _, s := range x[done.x:start.x] {
+			ctext = append(ctext, "-"+s)
+			count.x++
+		}
+		for _, s := range y[done.y:start.y] {
+			ctext = append(ctext, "+"+s)
+			count.y++
+		}
+
+		// too few common lines to split chunk, so chunk continues
+		if (end.x < len(x) || end.y < len(y)) && (end.x-start.x < context || (len(ctext) > 0 && end.x-start.x < 2*context)) {
+			for _, s := range x[start.x:end.x] {
+				ctext = append(ctext, " "+s)
+				count.x++
+				count.y++
+			}
+			done = end
+			continue
+		}
+
+		// end chunk with common lines
+		if len(ctext) > 0 {
+			n := min(end.x-start.x, context)
+			for _, s := range x[start.x : start.x+n] {
+				ctext = append(ctext, " "+s)
+				count.x++
+				count.y++
+			}
+			done = pair{start.x + n, start.y + n}
+
+			// line numbers are 1-indexed, except empty file
+			if count.x > 0 {
+				chunk.x++
+			}
+			if count.y > 0 {
+				chunk.y++
+			}
+			fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", chunk.x, count.x, chunk.y, count.y)
+			for _, s := range ctext {
+				out.WriteString(s)
+			}
+			count.x, count.y = 0, 0
+			ctext = ctext[:0]
+		}
+
+		if end.x >= len(x) && end.y >= len(y) {
+			break
+		}
+
+		// start new chunk with common lines
+		chunk = pair{max(end.x-context, done.x), max(end.y-context, done.y)}
+		for _, s := range x[chunk.x:end.x] {
+			ctext = append(ctext, " "+s)
+			count.x++
+			count.y++
+		}
+		done = end
+	}
+
+	return out.Bytes()
+}
+
+// lines splits text into lines, each ending with new line
+func lines(text []byte) []string {
+	if len(text) == 0 {
+		return nil
+	}
+	ls := strings.SplitAfter(string(text), "\n")
+	if ls[len(ls)-1] == "" {
+		ls = ls[:len(ls)-1]
+	} else {
+		ls[len(ls)-1] += "\n\\ No newline at end of file\n"
+	}
+	return ls
+}
+
+// anchors returns longest increasing sequence of pairs of lines that appear exactly once in both x and y.
+// Sentinel pairs {0,0} and {len(x),len(y)} are added at start and end.
+func anchors(x, y []string) []pair {
+	// count of each line, as 0, 1, many encoded as 0, -1, -2 for x and 0, -4, -8 for y
+	m := make(map[string]int)
+	for _, s := range x {
+		if c := m[s]; c > -2 {
+			m[s] = c - 1
+		}
+	}
+	for _, s := range y {
+		if c := m[s]; c > -8 {
+			m[s] = c - 4
+		}
+	}
+
+	// unique lines in both are -1 + -4, they are replaced with index in yi
+	var xi, yi, inv []int
+	for i, s := range y {
+		if m[s] == -1+-4 {
+			m[s] = len(yi)
+			yi = append(yi, i)
+		}
+	}
+	for i, s := range x {
+		if j, ok := m[s]; ok && j >= 0 {
+			xi = append(xi, i)
+			inv = append(inv, j)
+		}
+	}
+
+	// longest increasing subsequence of inv
+	n := len(inv)
+	tail := make([]int, n)
+	length := make([]int, n)
+	for i := range tail {
+		tail[i] = n + 1
+	}
+	for i, v := range inv {
+		k := sort.Search(n, func(k int) bool { return tail[k] >= v })
+		tail[k] = v
+		length[i] = k + 1
+	}
+
+	k := 0
+	for _, v := range length {
+		k = max(k, v)
+	}
+
+	seq := make([]pair, 2+k)
+	seq[0] = pair{0, 0}
+	seq[1+k] = pair{len(x), len(y)}
+	last := n
+	for i := n - 1; i >= 0 && k > 0; i-- {
+		if length[i] == k && inv[i] < last {
+			seq[k] = pair{xi[i], yi[inv[i]]}
+			last = inv[i]
+			k--
+		}
+	}
+	return seq
+}
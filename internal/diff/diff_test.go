@@ -0,0 +1,53 @@
+package diff_test
+
+import (
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/internal/diff"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		diff     string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+			diff: "",
+		},
+		{
+			name: "insert",
+			old:  "a\nb\nc\n",
+			new:  "a\nb\nx\nc\n",
+			diff: "diff old new\n--- old\n+++ new\n@@ -1,3 +1,4 @@\n a\n b\n+x\n c\n",
+		},
+		{
+			name: "delete",
+			old:  "a\nb\nc\n",
+			new:  "a\nc\n",
+			diff: "diff old new\n--- old\n+++ new\n@@ -1,3 +1,2 @@\n a\n-b\n c\n",
+		},
+		{
+			name: "separate chunks",
+			old:  "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n",
+			new:  "0\n1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n",
+			diff: "diff old new\n--- old\n+++ new\n@@ -1,3 +1,4 @@\n+0\n 1\n 2\n 3\n@@ -8,3 +9,4 @@\n 8\n 9\n 10\n+11\n",
+		},
+		{
+			name: "no new line at end",
+			old:  "a\nb",
+			new:  "a\nc",
+			diff: "diff old new\n--- old\n+++ new\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if d := string(diff.Diff("old", []byte(tc.old), "new", []byte(tc.new))); d != tc.diff {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package example
+
+import (
+	"context"
+)
+
+var Handler = func(ctx context.Context) error {
+	return nil
+}
+
+type Server struct{}
+
+func (s *Server) Handle(ctx context.Context) error {
+	first := func(ctx context.Context) error {
+		nested := func(ctx context.Context) error {
+			return nil
+		}
+		return nested(ctx)
+	}
+	second := func(ctx context.Context) error {
+		return nil
+	}
+	if err := first(ctx); err != nil {
+		return err
+	}
+	return second(ctx)
+}
+
+func Run(ctx context.Context) error {
+	noContext := func() error {
+		return nil
+	}
+	withContext := func(ctx context.Context) error {
+		return noContext()
+	}
+	return withContext(ctx)
+}
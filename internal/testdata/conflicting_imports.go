@@ -0,0 +1,31 @@
+package example
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	trace.SpanFromContext(r.Context()).AddEvent(r.URL.Path)
+}
+
+func Tag(ctx context.Context, attribute string, semconv int) {
+	trace.SpanFromContext(ctx).AddEvent(attribute)
+}
+
+type Tracer struct{ Name string }
+
+var tracer = Tracer{Name: "example"}
+
+func Trace(ctx context.Context) (Tracer, error) {
+	return tracer, nil
+}
+
+type Task struct{ Name string }
+
+func Run(ctx context.Context, task Task) error {
+	trace.SpanFromContext(ctx).AddEvent(task.Name)
+	return nil
+}
@@ -0,0 +1,33 @@
+package example
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gofiber/fiber/v2"
+	"github.com/labstack/echo/v4"
+)
+
+func HandleGin(c *gin.Context) {
+	c.Status(200)
+}
+
+func HandleEcho(c echo.Context) error {
+	return c.NoContent(200)
+}
+
+func HandleFiber(c *fiber.Ctx) error {
+	return c.SendStatus(200)
+}
+
+type Worker struct {
+	ctx context.Context
+}
+
+func (w *Worker) Run() {
+	w.ctx = nil
+}
+
+func (w Worker) Name() string {
+	return "worker"
+}
@@ -0,0 +1,33 @@
+package example
+
+import (
+	. "context"
+	stdctx "context"
+)
+
+type Ctx = stdctx.Context
+
+type RequestContext interface {
+	stdctx.Context
+	RequestID() string
+}
+
+func AliasedImport(ctx stdctx.Context) (err error) {
+	return nil
+}
+
+func DotImport(ctx Context) (err error) {
+	return nil
+}
+
+func TypeAlias(ctx Ctx) (err error) {
+	return nil
+}
+
+func EmbeddedInterface(ctx RequestContext) (err error) {
+	return nil
+}
+
+func NotContext(ctx string) (err error) {
+	return nil
+}
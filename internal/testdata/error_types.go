@@ -0,0 +1,38 @@
+package example
+
+import (
+	"context"
+)
+
+type MyError struct{}
+
+func (e *MyError) Error() string { return "my error" }
+
+type CodeError interface {
+	error
+	Code() int
+}
+
+type ValueError struct{}
+
+func (e ValueError) Error() string { return "value error" }
+
+func BuiltinError(ctx context.Context) (err error) {
+	return nil
+}
+
+func PointerError(ctx context.Context) (err *MyError) {
+	return nil
+}
+
+func InterfaceError(ctx context.Context) (err CodeError) {
+	return nil
+}
+
+func SkippedValueError(ctx context.Context) (err ValueError) {
+	return ValueError{}
+}
+
+func SkippedNotError(ctx context.Context) (err MyError) {
+	return MyError{}
+}
@@ -0,0 +1,24 @@
+package example
+
+import (
+	"context"
+)
+
+type Cache[K comparable, V any] struct{}
+
+func (c *Cache[K, V]) Get(ctx context.Context, key K) (v V, err error) {
+	return v, nil
+}
+
+func (c Cache[K, V]) Len(ctx context.Context) int {
+	return 0
+}
+
+type List[T any] struct{}
+
+func (l *List[T]) Push(ctx context.Context, v T) {
+}
+
+func (l List[_]) Len(ctx context.Context) int {
+	return 0
+}
@@ -0,0 +1,55 @@
+package example
+
+import (
+	"context"
+	"sync"
+)
+
+func Fetch(ctx context.Context, ids []int) {
+	var wg sync.WaitGroup
+	for _, id := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fetch(ctx, id)
+		}()
+	}
+	wg.Wait()
+}
+
+func Notify(ctx context.Context) {
+	go func() {
+		println("notify")
+	}()
+}
+
+func Nested(ctx context.Context) {
+	go func() {
+		go func() {
+			fetch(ctx, 1)
+		}()
+	}()
+}
+
+func WithContext(ctx context.Context) {
+	go func(ctx context.Context) {
+		fetch(ctx, 1)
+	}(ctx)
+}
+
+type key struct{}
+
+func WithValue(ctx context.Context, id int) {
+	go func() {
+		ctx := context.WithValue(ctx, key{}, id)
+		fetch(ctx, id)
+	}()
+}
+
+func WithoutContext() {
+	go func() {
+		println("no context")
+	}()
+}
+
+func fetch(ctx context.Context, id int) {}
@@ -0,0 +1,31 @@
+package example
+
+import (
+	"context"
+	"net/http"
+)
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func HandleWithError(w http.ResponseWriter, req *http.Request) (err error) {
+	return nil
+}
+
+func HandleWithContextName(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	_ = ctx
+}
+
+func HandleWithContext(ctx context.Context, r *http.Request) {
+}
+
+func HandleUnnamed(http.ResponseWriter, *http.Request) {
+}
+
+type Server struct{}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}).ServeHTTP(w, r)
+}
@@ -0,0 +1,26 @@
+package example
+
+import (
+	"context"
+	"time"
+)
+
+type UserID string
+
+type Level uint8
+
+func Basic(ctx context.Context, name string, count int, size int64, ratio float64, enabled bool) error {
+	return nil
+}
+
+func Converted(ctx context.Context, id UserID, level Level, port uint16, score float32) error {
+	return nil
+}
+
+func Skipped(ctx context.Context, password string, apiKey string, _ string, tags []string, at time.Time, user *UserID) error {
+	return nil
+}
+
+func NoAttributes(ctx context.Context, tags []string) error {
+	return nil
+}
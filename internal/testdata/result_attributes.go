@@ -0,0 +1,21 @@
+package example
+
+import (
+	"context"
+)
+
+func Count(ctx context.Context) (count int, found bool, err error) {
+	return 0, false, nil
+}
+
+func Name(ctx context.Context) (name string) {
+	return "fluffer"
+}
+
+func Skipped(ctx context.Context) (token string, tags []string, _ int) {
+	return "", nil, 0
+}
+
+func Unnamed(ctx context.Context) (int, error) {
+	return 0, nil
+}
@@ -0,0 +1,21 @@
+package example
+
+import "strings"
+
+func Run() {
+	Normalize("a")
+}
+
+func Normalize(s string) string {
+	return strings.ToLower(s)
+}
+
+func Sum(xs []int) (total int, err error) {
+	for _, x := range xs {
+		total += x
+	}
+	return total, nil
+}
+
+func Skip() {
+}
@@ -0,0 +1,39 @@
+package example
+
+import (
+	"context"
+)
+
+type GetCatRequest struct{}
+
+type GetCatResponse struct{}
+
+type UnimplementedCatServiceServer struct{}
+
+func (UnimplementedCatServiceServer) GetCat(context.Context, *GetCatRequest) (*GetCatResponse, error) {
+	return nil, nil
+}
+
+func (UnimplementedCatServiceServer) mustEmbedUnimplementedCatServiceServer() {}
+
+type catServer struct {
+	UnimplementedCatServiceServer
+}
+
+func (s *catServer) GetCat(ctx context.Context, req *GetCatRequest) (*GetCatResponse, error) {
+	return s.load(ctx)
+}
+
+func (s *catServer) load(ctx context.Context) (*GetCatResponse, error) {
+	return &GetCatResponse{}, nil
+}
+
+type CatClient struct{}
+
+func (c *CatClient) GetCat(ctx context.Context, req *GetCatRequest) (*GetCatResponse, error) {
+	return nil, nil
+}
+
+func Internal(ctx context.Context) error {
+	return nil
+}
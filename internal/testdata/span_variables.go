@@ -0,0 +1,51 @@
+package example
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+)
+
+type Span struct{ ID int }
+
+func (s Span) End() {}
+
+type Task struct{ ID int }
+
+func (t *Task) Close() error { return nil }
+
+type Queue interface {
+	Span() (Span, bool)
+	Next() (int, *Task)
+}
+
+var tracer = otel.Tracer("example")
+
+func Spans(ctx context.Context, q Queue) (int, error) {
+	span, ok := q.Span()
+	defer span.End()
+	if !ok {
+		return 0, nil
+	}
+	return span.ID, nil
+}
+
+func Worker(q Queue) int {
+	v, task := q.Next()
+	defer task.Close()
+	return v
+}
+
+func WorkerWithContext(ctx context.Context, q Queue) int {
+	v, task := q.Next()
+	defer task.Close()
+	return v
+}
+
+func Handwritten(ctx context.Context, q Queue) int {
+	ctx, span := tracer.Start(ctx, "Handwritten")
+	defer span.End()
+	v, task := q.Next()
+	defer task.Close()
+	return v
+}
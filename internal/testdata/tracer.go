@@ -0,0 +1,7 @@
+package example
+
+import (
+	"go.opentelemetry.io/otel"
+)
+
+var tracer = otel.Tracer("example")
@@ -0,0 +1,41 @@
+package example
+
+import (
+	"context"
+	"errors"
+)
+
+func SingleError(ctx context.Context) error {
+	return nil
+}
+
+func ValueAndError(ctx context.Context) (int, error) {
+	return 42, nil
+}
+
+func ErrorUsedInBody(ctx context.Context) (string, error) {
+	err := errors.New("fail")
+	if err != nil {
+		return "", err
+	}
+	return "ok", nil
+}
+
+func ErrorNamesUsedInBody(ctx context.Context) error {
+	err, err1 := errors.New("a"), errors.New("b")
+	return errors.Join(err, err1)
+}
+
+func MultipleErrors(ctx context.Context) (error, error) {
+	return nil, nil
+}
+
+func NoError(ctx context.Context) (int, string) {
+	return 0, ""
+}
+
+func AnonymousUnnamedResults() func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return nil
+	}
+}
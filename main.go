@@ -1,90 +1,409 @@
 package main
 
 import (
+	"bytes"
 	"errors"
 	"flag"
+	"fmt"
 	"go/ast"
+	"go/build"
 	"go/format"
 	"go/parser"
 	"go/token"
-	"io"
+	"maps"
 	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
 
-	"github.com/nikolaydubina/go-instrument/instrument"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+
+	"github.com/nikolaydubina/go-instrument/internal/config"
+	"github.com/nikolaydubina/go-instrument/internal/diff"
 	"github.com/nikolaydubina/go-instrument/processor"
 )
 
+type options struct {
+	config.Options
+	overwrite bool
+	remove    bool
+	diff      bool
+	list      bool
+	check     bool
+
+	// declared are package level names declared by instrumentation in this run, by directory and package name
+	declared map[string]map[string]bool
+}
+
+var errNotInstrumented = errors.New("not instrumented")
+
 func main() {
 	var (
-		fileName            string
-		overwrite           bool
-		app                 string
-		skipGenerated       bool
-		preserveLineNumbers bool
+		fileName   string
+		configName string
+		opts       options
 	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [-filename file.go | packages]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.StringVar(&fileName, "filename", "", "go file to instrument")
-	flag.StringVar(&app, "app", "app", "name of application")
-	flag.BoolVar(&overwrite, "w", false, "overwrite original file")
-	flag.BoolVar(&skipGenerated, "skip-generated", false, "skip generated files")
-	flag.BoolVar(&preserveLineNumbers, "preserve-line-numbers", true, "use compiler directives to preserve line numbers as if no instrumentation was applied (e.g. keep same line numbers in panic as if no instrumentation)")
+	flag.StringVar(&configName, "config", "", "config file with flags as keys, by default "+strings.Join(config.FileNames, " or ")+" is searched in target directory and its parents")
+	flag.BoolVar(&opts.overwrite, "w", false, "overwrite original file")
+	flag.BoolVar(&opts.diff, "d", false, "display diffs instead of rewriting files")
+	flag.BoolVar(&opts.list, "l", false, "list files whose instrumentation differs")
+	flag.BoolVar(&opts.check, "check", false, "exit with error if any function with context is not instrumented")
+	flag.BoolVar(&opts.remove, "remove", false, "remove previously inserted instrumentation")
+	opts.RegisterFlags(flag.CommandLine)
 	flag.Parse()
 
-	if err := process(fileName, app, overwrite, skipGenerated, preserveLineNumbers); err != nil {
-		os.Stderr.WriteString(err.Error())
+	opts.declared = make(map[string]map[string]bool)
+
+	if configName == "" {
+		dirs := []string{"."}
+		if fileName != "" {
+			dirs = []string{filepath.Dir(fileName)}
+		} else if patterns := flag.Args(); len(patterns) > 0 {
+			dirs = nil
+			for _, q := range patterns {
+				dirs = append(dirs, patternDir(q))
+			}
+		}
+		var err error
+		if configName, err = findConfig(dirs); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+	if configName != "" {
+		if err := config.Apply(flag.CommandLine, configName); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if err := opts.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	var err error
+	if patterns := flag.Args(); fileName == "" && len(patterns) > 0 {
+		err = processPackages(patterns, opts)
+	} else {
+		err = process(fileName, nil, opts)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
-func process(fileName, app string, overwrite, skipGenerated, preserveLineNumbers bool) error {
-	if fileName == "" {
-		return errors.New("missing file name")
+// findConfig returns config file of directories, which must be the same for all of them
+func findConfig(dirs []string) (string, error) {
+	var configName string
+	for i, dir := range dirs {
+		name, err := config.Find(dir)
+		if err != nil {
+			return "", err
+		}
+		if i > 0 && name != configName {
+			return "", fmt.Errorf("packages have different config files %q and %q, set -config", configName, name)
+		}
+		configName = name
 	}
+	return configName, nil
+}
 
-	src, err := os.ReadFile(fileName)
+// patternDir is directory of package pattern relative to current directory (e.g. ./svc/...), or current directory for import path pattern
+func patternDir(pattern string) string {
+	dir := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+	if dir == "" || (!build.IsLocalImport(dir) && !filepath.IsAbs(dir)) {
+		return "."
+	}
+	return dir
+}
+
+// processPackages instruments every file of every package matched by patterns (e.g. ./...).
+// Failures are collected per file, so that single bad file does not stop processing of the rest.
+func processPackages(patterns []string, opts options) error {
+	pkgs, err := loadPackages(opts, relativePath, patterns...)
 	if err != nil {
 		return err
 	}
 
+	var errs []error
+	visited := make(map[string]bool)
+	// files that are not instrumented are listed, and reported once
+	notInstrumented := false
+
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			errs = append(errs, fmt.Errorf("%s: %s", pkg.PkgPath, e.Msg))
+		}
+
+		if opts.Types {
+			for _, file := range pkg.Syntax {
+				fileName := pkg.Fset.Position(file.Pos()).Filename
+				// files generated by build (e.g. cgo) are not instrumented
+				if visited[fileName] || !slices.ContainsFunc(pkg.GoFiles, func(q string) bool { return relativePath(q) == fileName }) {
+					continue
+				}
+				visited[fileName] = true
+
+				if err := processFile(pkg.Fset, file, fileName, pkg, opts); errors.Is(err, errNotInstrumented) {
+					notInstrumented = true
+				} else if err != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", fileName, err))
+				}
+			}
+			continue
+		}
+
+		for _, fileName := range pkg.GoFiles {
+			fileName = relativePath(fileName)
+			if visited[fileName] {
+				continue
+			}
+			visited[fileName] = true
+
+			if err := process(fileName, pkg, opts); errors.Is(err, errNotInstrumented) {
+				notInstrumented = true
+			} else if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", fileName, err))
+			}
+		}
+	}
+
+	if notInstrumented {
+		errs = append(errs, errNotInstrumented)
+	}
+	return errors.Join(errs...)
+}
+
+// loadPackages loads packages of patterns, syntax of files is parsed under name given by fileName of absolute path of file
+func loadPackages(opts options, fileName func(string) string, patterns ...string) ([]*packages.Package, error) {
+	cfg := packages.Config{Mode: packages.NeedName | packages.NeedFiles}
+	if opts.Types {
+		// dependencies are type checked from source, since export data of newer toolchains may be unreadable
+		cfg.Mode |= packages.NeedCompiledGoFiles | packages.NeedImports | packages.NeedDeps | packages.NeedSyntax | packages.NeedTypes | packages.NeedTypesInfo | packages.NeedTypesSizes
+		cfg.ParseFile = func(fset *token.FileSet, name string, src []byte) (*ast.File, error) {
+			return parseFile(fset, fileName(name), src)
+		}
+	}
+	return packages.Load(&cfg, patterns...)
+}
+
+// relativePath is path of file relative to working directory, so that line directives and listed files do not depend on location of checkout
+func relativePath(fileName string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fileName
+	}
+	rel, err := filepath.Rel(wd, fileName)
+	if err != nil {
+		return fileName
+	}
+	return rel
+}
+
+// parseFile parses formatted source, so that positions in AST match positions in source after printing
+func parseFile(fset *token.FileSet, fileName string, src []byte) (*ast.File, error) {
 	formattedSrc, err := format.Source(src)
+	if err != nil {
+		return nil, err
+	}
+	return parser.ParseFile(fset, fileName, formattedSrc, parser.ParseComments)
+}
+
+func process(fileName string, pkg *packages.Package, opts options) error {
+	if fileName == "" {
+		return errors.New("missing file name")
+	}
+
+	if opts.Types && pkg == nil {
+		return processWithTypes(fileName, opts)
+	}
+
+	src, err := os.ReadFile(fileName)
 	if err != nil {
 		return err
 	}
 
 	fset := token.NewFileSet()
 
-	file, err := parser.ParseFile(fset, fileName, formattedSrc, parser.ParseComments)
+	file, err := parseFile(fset, fileName, src)
 	if err != nil || file == nil {
 		return err
 	}
-	if skipGenerated && ast.IsGenerated(file) {
+
+	return processFile(fset, file, fileName, pkg, opts)
+}
+
+// processWithTypes loads package of single file with type information, file is parsed under given name as without types
+func processWithTypes(fileName string, opts options) error {
+	absFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := loadPackages(opts, func(name string) string {
+		if name == absFileName {
+			return fileName
+		}
+		return name
+	}, "file="+absFileName)
+	if err != nil {
+		return err
+	}
+
+	for _, pkg := range pkgs {
+		for _, file := range pkg.Syntax {
+			if pkg.Fset.Position(file.Pos()).Filename == fileName {
+				return processFile(pkg.Fset, file, fileName, pkg, opts)
+			}
+		}
+		if len(pkg.Errors) > 0 {
+			return errors.New(pkg.Errors[0].Msg)
+		}
+	}
+
+	return errors.New("file not found in any package")
+}
+
+// packagePath resolves import path of package in directory from go.mod, or empty if directory is not in module
+func packagePath(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for root := dir; ; root = filepath.Dir(root) {
+		if b, err := os.ReadFile(filepath.Join(root, "go.mod")); err == nil {
+			rel, err := filepath.Rel(root, dir)
+			if err != nil || modfile.ModulePath(b) == "" {
+				return ""
+			}
+			return path.Join(modfile.ModulePath(b), filepath.ToSlash(rel))
+		}
+		if filepath.Dir(root) == root {
+			return ""
+		}
+	}
+}
+
+// packageNames collects package level names declared in other go files of package of file
+func packageNames(fileName, pkgName string) (map[string]bool, error) {
+	abs, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+	others, err := filepath.Glob(filepath.Join(filepath.Dir(abs), "*.go"))
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool)
+	for _, other := range others {
+		if other == abs || (strings.HasSuffix(other, "_test.go") && !strings.HasSuffix(abs, "_test.go")) {
+			continue
+		}
+		// bad files are reported when they are processed
+		file, err := parser.ParseFile(token.NewFileSet(), other, nil, parser.SkipObjectResolution)
+		if err != nil || file.Name.Name != pkgName {
+			continue
+		}
+		maps.Copy(names, processor.DeclaredNames(file))
+	}
+	return names, nil
+}
+
+func processFile(fset *token.FileSet, file *ast.File, fileName string, pkg *packages.Package, opts options) error {
+	if opts.SkipGenerated && ast.IsGenerated(file) {
+		return nil
+	}
+
+	p, err := opts.NewProcessor()
+	if err != nil {
+		return err
+	}
+	if pkg != nil {
+		p.PackagePath, p.Types, p.TypesInfo = pkg.PkgPath, pkg.Types, pkg.TypesInfo
+	} else {
+		p.PackagePath = packagePath(filepath.Dir(fileName))
+	}
+
+	declaredKey := filepath.Dir(fileName) + " " + file.Name.Name
+	if d, ok := p.FuncInstrumenter.(processor.PackageDeclInstrumenter); ok && len(d.PackageDecls()) > 0 {
+		if p.PackageNames, err = packageNames(fileName, file.Name.Name); err != nil {
+			return err
+		}
+		maps.Copy(p.PackageNames, opts.declared[declaredKey])
+	}
+
+	var before bytes.Buffer
+	if opts.check {
+		if err := format.Node(&before, fset, file); err != nil {
+			return err
+		}
+	}
+
+	process := p.Process
+	if opts.remove {
+		process = p.Remove
+	}
+	if err := process(fset, file); err != nil {
+		return err
+	}
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, file); err != nil {
+		return err
+	}
+
+	if opts.declared[declaredKey] == nil {
+		opts.declared[declaredKey] = make(map[string]bool)
+	}
+	maps.Copy(opts.declared[declaredKey], processor.DeclaredNames(file))
+
+	if opts.check {
+		if !bytes.Equal(before.Bytes(), out.Bytes()) {
+			fmt.Println(fileName)
+			return errNotInstrumented
+		}
 		return nil
 	}
 
-	p := processor.Processor{
-		Instrumenter: &instrument.OpenTelemetry{
-			TracerName:             app,
-			ErrorStatusDescription: "error",
-		},
-		PreserveLineNumbers: preserveLineNumbers,
-		SpanName:            processor.BasicSpanName,
-		ContextPackage:      "context",
-		ContextType:         "Context",
-		ErrorType:           `error`,
+	if !opts.list && !opts.diff && !opts.overwrite {
+		_, err := os.Stdout.Write(out.Bytes())
+		return err
 	}
 
-	if err := p.Process(fset, file); err != nil {
+	src, err := os.ReadFile(fileName)
+	if err != nil {
 		return err
 	}
+	if bytes.Equal(src, out.Bytes()) {
+		return nil
+	}
 
-	var out io.Writer = os.Stdout
-	if overwrite {
+	if opts.list {
+		fmt.Println(fileName)
+	}
+	if opts.diff {
+		os.Stdout.Write(diff.Diff(fileName+".orig", src, fileName, out.Bytes()))
+	}
+	if opts.overwrite {
 		outf, err := os.OpenFile(fileName, os.O_RDWR|os.O_TRUNC, 0)
 		if err != nil {
 			return err
 		}
 		defer outf.Close()
-		out = outf
+		if _, err := outf.Write(out.Bytes()); err != nil {
+			return err
+		}
 	}
 
-	return format.Node(out, fset, file)
+	return nil
 }
@@ -15,7 +15,7 @@ import (
 
 func FuzzBadFile(f *testing.F) {
 	testbin := path.Join(f.TempDir(), "go-instrument-testbin")
-	exec.Command("go", "build", "-cover", "-o", testbin, "main.go").Run()
+	exec.Command("go", "build", "-cover", "-o", testbin, ".").Run()
 
 	f.Fuzz(func(t *testing.T, orig string) {
 		t.Run("when bad go file, then error", func(t *testing.T) {
@@ -33,7 +33,7 @@ func FuzzBadFile(f *testing.F) {
 
 func TestApp(t *testing.T) {
 	testbin := path.Join(t.TempDir(), "go-instrument-testbin")
-	exec.Command("go", "build", "-cover", "-o", testbin, "main.go").Run()
+	exec.Command("go", "build", "-cover", "-o", testbin, ".").Run()
 
 	t.Run("when basic, then ok", func(t *testing.T) {
 		f := randFileName(t)
@@ -129,6 +129,847 @@ func TestApp(t *testing.T) {
 		})
 	})
 
+	t.Run("when package pattern, then every file of every package is instrumented", func(t *testing.T) {
+		for _, args := range [][]string{nil, {"-types"}} {
+			t.Run(strings.Join(args, " "), func(t *testing.T) {
+				dir := newModule(t, map[string]string{"a/basic.go": "./internal/testdata/basic.go", "a/b/basic.go": "./internal/testdata/basic.go"})
+
+				cmd := exec.Command(testbin, append(args, "-w", "./...")...)
+				cmd.Dir = dir
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Error(err, string(out))
+				}
+
+				assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", path.Join(dir, "a", "basic.go"))
+				assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", path.Join(dir, "a", "b", "basic.go"))
+
+				// line directives refer to files relative to working directory
+				if b, _ := os.ReadFile(path.Join(dir, "a", "b", "basic.go")); !strings.Contains(string(b), "/*line a/b/basic.go:") {
+					t.Error(string(b))
+				}
+			})
+		}
+	})
+
+	t.Run("when types and file name, then line directives refer to file name as given", func(t *testing.T) {
+		dir := newModule(t, map[string]string{"a/basic.go": "./internal/testdata/basic.go"})
+
+		cmd := exec.Command(testbin, "-types", "-filename", "a/basic.go")
+		cmd.Dir = dir
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Error(err, string(out))
+		}
+		if !strings.Contains(string(out), "/*line a/basic.go:") {
+			t.Error(string(out))
+		}
+	})
+
+	t.Run("when package pattern and bad file, then error and other files instrumented", func(t *testing.T) {
+		dir := newModule(t, map[string]string{"a/basic.go": "./internal/testdata/basic.go"})
+		os.MkdirAll(path.Join(dir, "bad"), 0755)
+		if err := os.WriteFile(path.Join(dir, "bad", "bad.go"), []byte("package bad\n\nfunc {"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-w", "./...")
+		cmd.Dir = dir
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+		out, err := cmd.CombinedOutput()
+		if err == nil {
+			t.Error("expected exit code 1")
+		}
+		if !strings.Contains(string(out), "bad.go") {
+			t.Error(string(out))
+		}
+
+		assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", path.Join(dir, "a", "basic.go"))
+	})
+
+	t.Run("when types, then context and error detected by type", func(t *testing.T) {
+		for _, name := range []string{"context_types.go", "error_types.go"} {
+			t.Run(name, func(t *testing.T) {
+				f := instrumentInModule(t, testbin, path.Join("./internal/testdata", name), "-types")
+				assertEqFile(t, path.Join("./internal/testdata/instrumented", name+".exp"), f)
+			})
+		}
+	})
+
+	t.Run("when types and datadog, then nil of concrete error type is not recorded", func(t *testing.T) {
+		f := instrumentInModule(t, testbin, "./internal/testdata/error_types.go", "-types", "-instrumenter", "datadog")
+		assertEqFile(t, "./internal/testdata/instrumented/error_types_datadog.go.exp", f)
+	})
+
+	t.Run("when param attributes, then parameters of basic kinds are recorded", func(t *testing.T) {
+		f := instrumentInModule(t, testbin, "./internal/testdata/param_attributes.go", "-types", "-param-attributes")
+		assertEqFile(t, "./internal/testdata/instrumented/param_attributes.go.exp", f)
+	})
+
+	t.Run("when span kind, then gRPC servers and clients are detected", func(t *testing.T) {
+		f := instrumentInModule(t, testbin, "./internal/testdata/span_kind.go", "-types", "-span-kind")
+		assertEqFile(t, "./internal/testdata/instrumented/span_kind.go.exp", f)
+	})
+
+	t.Run("when file imports packages of same name, then inserted imports do not conflict", func(t *testing.T) {
+		f := instrumentInModule(t, testbin, "./internal/testdata/conflicting_imports.go", "-types", "-span-kind", "-param-attributes", "-record-panic")
+		assertEqFile(t, "./internal/testdata/instrumented/conflicting_imports.go.exp", f)
+	})
+
+	t.Run("when file declares names of datadog imports, then inserted imports do not conflict", func(t *testing.T) {
+		f := instrumentInModule(t, testbin, "./internal/testdata/conflicting_imports.go", "-instrumenter", "datadog")
+		assertEqFile(t, "./internal/testdata/instrumented/conflicting_imports_datadog.go.exp", f)
+	})
+
+	t.Run("when file declares names of runtime trace imports and variables, then inserted code does not conflict", func(t *testing.T) {
+		f := instrumentInModule(t, testbin, "./internal/testdata/conflicting_imports.go", "-instrumenter", "runtime-trace", "-name-results")
+		assertEqFile(t, "./internal/testdata/instrumented/conflicting_imports_runtime_trace.go.exp", f)
+	})
+
+	t.Run("when span kind with server and client types, then methods of these types are servers and clients", func(t *testing.T) {
+		cmd := exec.Command(testbin, "-span-kind", "-server-type", "^cat", "-client-type", "^Nothing$", "-filename", "./internal/testdata/span_kind.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Error(err, string(out))
+		}
+		for _, exp := range []string{
+			`Start(ctx, "catServer.GetCat", otelTrace.WithSpanKind(otelTrace.SpanKindServer))`,
+			`Start(ctx, "catServer.load", otelTrace.WithSpanKind(otelTrace.SpanKindServer))`,
+			`Start(ctx, "CatClient.GetCat")`,
+		} {
+			if !strings.Contains(string(out), exp) {
+				t.Error(exp, string(out))
+			}
+		}
+	})
+
+	t.Run("when result attributes, then named results of basic kinds are recorded", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/result_attributes.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-w", "-result-attributes", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/result_attributes.go.exp", f)
+	})
+
+	t.Run("when param attributes with types and names, then only selected parameters are recorded", func(t *testing.T) {
+		cmd := exec.Command(testbin, "-param-attributes", "-attribute-type", "string", "-attribute-type", "int", "-attribute-deny", "nAm", "-filename", "./internal/testdata/param_attributes.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Error(err, string(out))
+		}
+		if exp := `Start(ctx, "Basic", otelTrace.WithAttributes(otelAttribute.Int("count", count)))`; !strings.Contains(string(out), exp) {
+			t.Error(string(out))
+		}
+		if exp := `Start(ctx, "Converted")`; !strings.Contains(string(out), exp) {
+			t.Error(string(out))
+		}
+	})
+
+	t.Run("when name results, then unnamed error results are named and recorded", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/unnamed_results.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-w", "-name-results", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/unnamed_results.go.exp", f)
+
+		cmd = exec.Command(testbin, "-w", "-remove", "-name-results", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/unnamed_results.go", f)
+	})
+
+	t.Run("when generic receiver, then span name has type name", func(t *testing.T) {
+		tests := []struct {
+			args []string
+			exp  string
+		}{
+			{exp: "./internal/testdata/instrumented/generics.go.exp"},
+			{args: []string{"-receiver-type-params"}, exp: "./internal/testdata/instrumented/generics_type_params.go.exp"},
+		}
+		for _, tc := range tests {
+			t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+				f := randFileName(t)
+				if err := copy("./internal/testdata/generics.go", f); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd := exec.Command(testbin, append(tc.args, "-w", "-filename", f)...)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+				assertEqFile(t, tc.exp, f)
+			})
+		}
+	})
+
+	t.Run("when anonymous function, then span name is after enclosing function", func(t *testing.T) {
+		tests := []struct {
+			args []string
+			exp  string
+		}{
+			{exp: "./internal/testdata/instrumented/anonymous.go.exp"},
+			{args: []string{"-anonymous-func-line"}, exp: "./internal/testdata/instrumented/anonymous_line.go.exp"},
+		}
+		for _, tc := range tests {
+			t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+				f := randFileName(t)
+				if err := copy("./internal/testdata/anonymous.go", f); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd := exec.Command(testbin, append(tc.args, "-w", "-filename", f)...)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+				assertEqFile(t, tc.exp, f)
+			})
+		}
+	})
+
+	t.Run("when code attributes, then function, namespace, file and line are recorded", func(t *testing.T) {
+		f := path.Join(newModule(t, map[string]string{"a/anonymous.go": "./internal/testdata/anonymous.go"}), "a", "anonymous.go")
+
+		cmd := exec.Command(testbin, "-w", "-code-attributes", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Error(err, string(out))
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/anonymous_code_attributes.go.exp", f)
+	})
+
+	t.Run("tracer var", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			files  map[string]string
+			exp    int
+			expVar string
+		}{
+			{
+				name:   "when package has no tracer, then tracer is declared once",
+				files:  map[string]string{"anonymous.go": "./internal/testdata/anonymous.go", "generics.go": "./internal/testdata/generics.go"},
+				exp:    1,
+				expVar: "var tracer = otel.Tracer(\"app\")",
+			},
+			{
+				name:   "when package has tracer, then it is used",
+				files:  map[string]string{"anonymous.go": "./internal/testdata/anonymous.go", "tracer.go": "./internal/testdata/tracer.go"},
+				exp:    0,
+				expVar: "var tracer = otel.Tracer(\"example\")",
+			},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name, func(t *testing.T) {
+				dir := newModule(t, tc.files)
+
+				cmd := exec.Command(testbin, "-w", "-tracer-var", "tracer", "./...")
+				cmd.Dir = dir
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Error(err, string(out))
+				}
+
+				var all string
+				for name := range tc.files {
+					b, _ := os.ReadFile(path.Join(dir, name))
+					all += string(b)
+				}
+				if n := strings.Count(all, "var tracer = otel.Tracer(\"app\")"); n != tc.exp {
+					t.Error(n, all)
+				}
+				if !strings.Contains(all, tc.expVar) || !strings.Contains(all, `ctx, span := tracer.Start(ctx, "Server.Handle")`) || strings.Contains(all, "otel.Tracer(\"app\").Start") {
+					t.Error(all)
+				}
+
+				cmd = exec.Command(testbin, "-w", "-remove", "-tracer-var", "tracer", "./...")
+				cmd.Dir = dir
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Error(err, string(out))
+				}
+
+				for name, from := range tc.files {
+					assertEqFile(t, from, path.Join(dir, name))
+				}
+			})
+		}
+	})
+
+	t.Run("when http request, then context is from request and set back to request", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/http_request.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-w", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/http_request.go.exp", f)
+	})
+
+	t.Run("when http request and datadog or runtime trace region, then context is from request", func(t *testing.T) {
+		for instrumenter, exp := range map[string]string{
+			"datadog":              `span, ctx := ddTracer.StartSpanFromContext(r.Context(), "Handle", ddTracer.ServiceName("app"))`,
+			"runtime-trace-region": `defer rtTrace.StartRegion(r.Context(), "Handle").End()`,
+		} {
+			cmd := exec.Command(testbin, "-instrumenter", instrumenter, "-filename", "./internal/testdata/http_request.go")
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			out, err := cmd.CombinedOutput()
+			if err != nil {
+				t.Error(err, string(out))
+			}
+			if !strings.Contains(string(out), exp) {
+				t.Error(instrumenter, string(out))
+			}
+			if instrumenter == "runtime-trace-region" && strings.Contains(string(out), ".WithContext(") {
+				t.Error("context is not derived by region", string(out))
+			}
+		}
+	})
+
+	t.Run("when context sources, then context is from parameters and receiver", func(t *testing.T) {
+		args := []string{
+			"-context-source", `^\*gin\.Context$={{.Name}}.Request.Context();{{.Name}}.Request = {{.Name}}.Request.WithContext({{.Context}})`,
+			"-context-source", `^echo\.Context$={{.Name}}.Request().Context();{{.Name}}.SetRequest({{.Name}}.Request().WithContext({{.Context}}))`,
+			"-context-source", `^\*fiber\.Ctx$={{.Name}}.UserContext();{{.Name}}.SetUserContext({{.Context}})`,
+			"-context-receiver", `^\*?Worker$={{.Name}}.ctx`,
+		}
+
+		f := randFileName(t)
+		if err := copy("./internal/testdata/context_source.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, append([]string{"-w", "-filename", f}, args...)...)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/context_source.go.exp", f)
+
+		t.Run("when remove without line directives, then writeback is removed", func(t *testing.T) {
+			f := randFileName(t)
+			if err := copy("./internal/testdata/context_source.go", f); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(testbin, append([]string{"-w", "-preserve-line-numbers=false", "-filename", f}, args...)...)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+
+			cmd = exec.Command(testbin, append([]string{"-w", "-remove", "-filename", f}, args...)...)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+			assertEqFile(t, "./internal/testdata/context_source.go", f)
+		})
+	})
+
+	t.Run("when invalid context source, then error", func(t *testing.T) {
+		for _, v := range []string{`^\*gin\.Context$`, `(={{.Name}}.Context()`, `^x$={{.Name}}.(`, `^x$={{.Name}}.Context();{{.Name}} =`, `^x$={{.Unknown}}`} {
+			cmd := exec.Command(testbin, "-context-source", v, "-filename", "./internal/testdata/basic.go")
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err == nil {
+				t.Error(v)
+			}
+		}
+	})
+
+	t.Run("when root functions, then root span is started from background context", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/root.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-w", "-root", "^(Run|Normalize|Sum)$", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/root.go.exp", f)
+	})
+
+	t.Run("when root context, then root span is started from it", func(t *testing.T) {
+		cmd := exec.Command(testbin, "-root", "^Run$", "-root-context", "appctx.Root()", "-root-context-import", "github.com/org/svc/appctx", "-filename", "./internal/testdata/root.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		for _, exp := range []string{
+			`"github.com/org/svc/appctx"`,
+			`_, span := otel.Tracer("app").Start(appctx.Root(), "Run")`,
+			"func Normalize(s string) string {\n\treturn strings.ToLower(s)",
+		} {
+			if !strings.Contains(string(out), exp) {
+				t.Error(exp, string(out))
+			}
+		}
+		if strings.Contains(string(out), `"context"`) {
+			t.Error(string(out))
+		}
+	})
+
+	t.Run("when invalid root context, then error", func(t *testing.T) {
+		cmd := exec.Command(testbin, "-root", "^Run$", "-root-context", "appctx.Root(", "-filename", "./internal/testdata/root.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("when goroutines, then function literals launched by go statement are instrumented", func(t *testing.T) {
+		for _, mode := range []string{"child", "link"} {
+			t.Run(mode, func(t *testing.T) {
+				f := randFileName(t)
+				if err := copy("./internal/testdata/goroutine.go", f); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd := exec.Command(testbin, "-w", "-goroutines", mode, "-filename", f)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+				assertEqFile(t, "./internal/testdata/instrumented/goroutine_"+mode+".go.exp", f)
+			})
+		}
+	})
+
+	t.Run("when unknown goroutines, then error", func(t *testing.T) {
+		cmd := exec.Command(testbin, "-goroutines", "unknown", "-filename", "./internal/testdata/goroutine.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("when runtime trace instrumenter, then ok", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/basic.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-w", "-instrumenter", "runtime-trace", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err != nil {
+			t.Error(err)
+		}
+		assertEqFile(t, "./internal/testdata/instrumented/basic_runtime_trace.go.exp", f)
+	})
+
+	t.Run("when unknown instrumenter, then error", func(t *testing.T) {
+		cmd := exec.Command(testbin, "-instrumenter", "unknown", "-filename", "./internal/testdata/basic.go")
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		if err := cmd.Run(); err == nil {
+			t.Error("expected exit code 1")
+		}
+	})
+
+	t.Run("span name", func(t *testing.T) {
+		tests := []struct {
+			args []string
+			exp  []string
+		}{
+			{args: []string{"-span-name", "short"}, exp: []string{`"Cat.Name"`, `"Fib"`, `"AnonymousFunc.func1"`}},
+			{args: []string{"-span-name", "package"}, exp: []string{`"example.Cat.Name"`, `"example.Fib"`, `"example.AnonymousFunc.func1"`}},
+			{args: []string{"-span-name", "full"}, exp: []string{`"example/a.Cat.Name"`, `"example/a.(*Apple).MethodWithPointerReciver"`, `"example/a.Fib"`}},
+			{args: []string{"-span-name-template", "{{.PackagePath}}#{{.Function}}"}, exp: []string{`"example/a#Name"`, `"example/a#Fib"`}},
+			{args: []string{"-span-name-template", `{{printf "%q" .Function}}\`}, exp: []string{`"\"Name\"\\"`, `"\"Fib\"\\"`}},
+			{args: []string{"-instrumenter", "datadog", "-span-name-template", `{{printf "%q" .Function}}`}, exp: []string{`"\"Name\""`}},
+			{args: []string{"-instrumenter", "runtime-trace", "-span-name-template", `{{printf "%q" .Function}}`}, exp: []string{`"\"Name\""`}},
+		}
+		for _, tc := range tests {
+			t.Run(strings.Join(tc.args, " "), func(t *testing.T) {
+				f := path.Join(newModule(t, map[string]string{"a/basic.go": "./internal/testdata/basic.go"}), "a", "basic.go")
+
+				cmd := exec.Command(testbin, append(tc.args, "-filename", f)...)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				out, err := cmd.CombinedOutput()
+				if err != nil {
+					t.Error(err, string(out))
+				}
+				for _, s := range tc.exp {
+					if !strings.Contains(string(out), s) {
+						t.Error(s)
+					}
+				}
+			})
+		}
+
+		t.Run("when unknown span name or bad template, then error", func(t *testing.T) {
+			for _, args := range [][]string{{"-span-name", "unknown"}, {"-span-name-template", "{{.Unknown}}"}} {
+				cmd := exec.Command(testbin, append(args, "-filename", "./internal/testdata/basic.go")...)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err == nil {
+					t.Error("expected exit code 1", args)
+				}
+			}
+		})
+	})
+
+	t.Run("when already instrumented with any instrumenter, then do not instrument", func(t *testing.T) {
+		for _, instrumenter := range []string{"otel", "datadog", "runtime-trace", "runtime-trace-region"} {
+			t.Run(instrumenter, func(t *testing.T) {
+				f := randFileName(t)
+				if err := copy("./internal/testdata/basic.go", f); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd := exec.Command(testbin, "-w", "-instrumenter", instrumenter, "-filename", f)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+
+				instrumented := path.Join(t.TempDir(), "instrumented.go")
+				if err := copy(f, instrumented); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd = exec.Command(testbin, "-w", "-instrumenter", instrumenter, "-filename", f)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+				assertEqFile(t, instrumented, f)
+			})
+		}
+	})
+
+	t.Run("when functions declare span and task variables, then functions are instrumented", func(t *testing.T) {
+		f := path.Join(t.TempDir(), "span_variables.go")
+		if err := copy("./internal/testdata/span_variables.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-check", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+		if err := cmd.Run(); err == nil {
+			t.Error("expected exit code 1")
+		}
+
+		cmd = exec.Command(testbin, "-w", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Error(err, string(out))
+		}
+
+		assertEqFile(t, "./internal/testdata/instrumented/span_variables.go.exp", f)
+	})
+
+	t.Run("when remove, then instrumentation is removed", func(t *testing.T) {
+		for _, name := range []string{"basic.go.exp", "basic_no_line.go.exp"} {
+			t.Run(name, func(t *testing.T) {
+				f := randFileName(t)
+				if err := copy(path.Join("./internal/testdata/instrumented", name), f); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd := exec.Command(testbin, "-w", "-remove", "-filename", f)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+				assertEqFile(t, path.Join("./internal/testdata/removed", name), f)
+			})
+		}
+	})
+
+	t.Run("when remove and functions declare span and task variables, then only instrumentation is removed", func(t *testing.T) {
+		for _, name := range []string{"./internal/testdata/span_variables.go", "./internal/testdata/instrumented/span_variables.go.exp"} {
+			t.Run(name, func(t *testing.T) {
+				f := randFileName(t)
+				if err := copy(name, f); err != nil {
+					t.Fatal(err)
+				}
+
+				cmd := exec.Command(testbin, "-w", "-remove", "-filename", f)
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+				if err := cmd.Run(); err != nil {
+					t.Error(err)
+				}
+				assertEqFile(t, "./internal/testdata/span_variables.go", f)
+			})
+		}
+	})
+
+	t.Run("when list and diff, then file is not changed", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/basic.go", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-l", "-d", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		if !strings.HasPrefix(string(out), f+"\ndiff "+f+".orig "+f+"\n") {
+			t.Error(string(out))
+		}
+		if !strings.Contains(string(out), "\n+\tctx, span := otel.Tracer(\"app\").Start(ctx, \"Cat.Name\")\n") {
+			t.Error(string(out))
+		}
+		assertEqFile(t, "./internal/testdata/basic.go", f)
+	})
+
+	t.Run("when list and already instrumented, then nothing listed", func(t *testing.T) {
+		f := randFileName(t)
+		if err := copy("./internal/testdata/instrumented/basic.go.exp", f); err != nil {
+			t.Fatal(err)
+		}
+
+		cmd := exec.Command(testbin, "-l", "-filename", f)
+		cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+		out, err := cmd.Output()
+		if err != nil {
+			t.Error(err)
+		}
+		if len(out) != 0 {
+			t.Error(string(out))
+		}
+	})
+
+	t.Run("check", func(t *testing.T) {
+		t.Run("when not instrumented, then error", func(t *testing.T) {
+			cmd := exec.Command(testbin, "-check", "-filename", "./internal/testdata/basic.go")
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			out, err := cmd.Output()
+			if err == nil {
+				t.Error("expected exit code 1")
+			}
+			if string(out) != "./internal/testdata/basic.go\n" {
+				t.Error(string(out))
+			}
+		})
+
+		t.Run("when package pattern and not instrumented, then files are listed", func(t *testing.T) {
+			dir := newModule(t, map[string]string{"basic.go": "./internal/testdata/basic.go", "a/basic.go": "./internal/testdata/instrumented/basic.go.exp"})
+
+			cmd := exec.Command(testbin, "-check", "./...")
+			cmd.Dir = dir
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+			out, err := cmd.Output()
+			if err == nil {
+				t.Error("expected exit code 1")
+			}
+			if string(out) != "basic.go\n" {
+				t.Error(string(out))
+			}
+		})
+
+		t.Run("when instrumented, then ok", func(t *testing.T) {
+			f := randFileName(t)
+			if err := copy("./internal/testdata/instrumented/basic.go.exp", f); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(testbin, "-check", "-filename", f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+		})
+
+		t.Run("when no context, then ok", func(t *testing.T) {
+			f := randFileName(t)
+			if err := os.WriteFile(f, []byte("package example\n\nfunc A() error { return nil }\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(testbin, "-check", "-filename", f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+		})
+	})
+
+	t.Run("filter", func(t *testing.T) {
+		t.Run("when function excluded, then function is not changed", func(t *testing.T) {
+			f := randFileName(t)
+			if err := copy("./internal/testdata/basic.go", f); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(testbin, "-w", "-exclude", `^Cat\.Name$`, "-exclude", `^Apple\.`, "-filename", f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err != nil {
+				t.Error(err)
+			}
+
+			b, _ := os.ReadFile(f)
+			for _, s := range []string{
+				"func (s Cat) Name(ctx context.Context) (name string, err error) {\n\treturn \"fluffer\", nil\n}",
+				"func (s Apple) MethodWithValueReciver(ctx context.Context, a int) (err error) {\n\treturn nil\n}",
+				`Start(ctx, "Basic")`,
+			} {
+				if !strings.Contains(string(b), s) {
+					t.Error(s)
+				}
+			}
+		})
+
+		t.Run("when package or file excluded, then files are not changed", func(t *testing.T) {
+			dir := newModule(t, map[string]string{"a/basic.go": "./internal/testdata/basic.go", "b/basic.go": "./internal/testdata/basic.go", "c/basic.go": "./internal/testdata/basic.go"})
+
+			cmd := exec.Command(testbin, "-w", "-exclude-package", `^example/b$`, "-exclude-file", `c/basic\.go$`, "./...")
+			cmd.Dir = dir
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Error(err, string(out))
+			}
+
+			assertEqFile(t, "./internal/testdata/instrumented/basic.go.exp", path.Join(dir, "a", "basic.go"))
+			assertEqFile(t, "./internal/testdata/basic.go", path.Join(dir, "b", "basic.go"))
+			assertEqFile(t, "./internal/testdata/basic.go", path.Join(dir, "c", "basic.go"))
+		})
+
+		t.Run("when bad regular expression, then error", func(t *testing.T) {
+			cmd := exec.Command(testbin, "-include", "(", "-filename", "./internal/testdata/basic.go")
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR=./coverage")
+			if err := cmd.Run(); err == nil {
+				t.Error("expected exit code 1")
+			}
+		})
+	})
+
+	t.Run("config", func(t *testing.T) {
+		tests := []struct {
+			name   string
+			config string
+			args   []string
+			exp    []string
+			notExp []string
+		}{
+			{
+				name:   ".go-instrument.yaml",
+				config: "app: my-service\nerror-status-description: failed\nexclude:\n  - ^Cat\\.\n  - ^Apple\\.\n",
+				exp:    []string{`otel.Tracer("my-service").Start(ctx, "Basic")`, `"failed"`},
+				notExp: []string{`"Cat.Name"`, `"Apple.`},
+			},
+			{
+				name:   ".go-instrument.json",
+				config: `{"app": "my-service", "instrumenter": "datadog", "exclude": ["^Cat\\."]}`,
+				exp:    []string{`ddTracer.ServiceName("my-service")`},
+				notExp: []string{`"Cat.Name"`},
+			},
+			{
+				name:   ".go-instrument.yaml",
+				config: "app: my \"service\"\nerror-status-description: bad \"x\"\n",
+				exp:    []string{`otel.Tracer("my \"service\"")`, `"bad \"x\""`},
+			},
+			{
+				name:   ".go-instrument.json",
+				config: `{"app": "my \"service\"", "instrumenter": "datadog"}`,
+				exp:    []string{`ddTracer.ServiceName("my \"service\"")`},
+			},
+			{
+				name:   ".go-instrument.yaml",
+				config: "app: my-service\nexclude:\n  - ^Cat\\.\n",
+				args:   []string{"-app", "other-service", "-exclude", "^Apple\\."},
+				exp:    []string{`otel.Tracer("other-service")`, `"Cat.Name"`},
+				notExp: []string{`"Apple.`, "my-service"},
+			},
+		}
+		for _, tc := range tests {
+			t.Run(tc.name+strings.Join(tc.args, " "), func(t *testing.T) {
+				dir := newModule(t, map[string]string{"a/b/basic.go": "./internal/testdata/basic.go"})
+				if err := os.WriteFile(path.Join(dir, tc.name), []byte(tc.config), 0644); err != nil {
+					t.Fatal(err)
+				}
+				f := path.Join(dir, "a", "b", "basic.go")
+
+				cmd := exec.Command(testbin, append(append([]string{"-w"}, tc.args...), "./...")...)
+				cmd.Dir = path.Join(dir, "a")
+				cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+				if out, err := cmd.CombinedOutput(); err != nil {
+					t.Error(err, string(out))
+				}
+
+				b, _ := os.ReadFile(f)
+				for _, s := range tc.exp {
+					if !strings.Contains(string(b), s) {
+						t.Error(s)
+					}
+				}
+				for _, s := range tc.notExp {
+					if strings.Contains(string(b), s) {
+						t.Error(s)
+					}
+				}
+			})
+		}
+
+		t.Run("when package pattern, then config is searched from directory of pattern", func(t *testing.T) {
+			dir := newModule(t, map[string]string{"svc/basic.go": "./internal/testdata/basic.go", "other/basic.go": "./internal/testdata/basic.go"})
+			for _, name := range []string{"svc", "other"} {
+				if err := os.WriteFile(path.Join(dir, name, ".go-instrument.yaml"), []byte("app: "+name+"\n"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cmd := exec.Command(testbin, "-w", "./svc/...")
+			cmd.Dir = dir
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+			if out, err := cmd.CombinedOutput(); err != nil {
+				t.Error(err, string(out))
+			}
+			if b, _ := os.ReadFile(path.Join(dir, "svc", "basic.go")); !strings.Contains(string(b), `otel.Tracer("svc")`) {
+				t.Error(string(b))
+			}
+
+			cmd = exec.Command(testbin, "./svc/...", "./other/...")
+			cmd.Dir = dir
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+			if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "different config files") {
+				t.Error("expected error of different config files", string(out))
+			}
+		})
+
+		t.Run("when unknown key, then error", func(t *testing.T) {
+			dir := t.TempDir()
+			f := path.Join(dir, "basic.go")
+			if err := copy("./internal/testdata/basic.go", f); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path.Join(dir, ".go-instrument.yaml"), []byte("unknown: 1\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := exec.Command(testbin, "-filename", f)
+			cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+			if err := cmd.Run(); err == nil {
+				t.Error("expected exit code 1")
+			}
+		})
+	})
+
 	t.Run("when already instrumented, then do not instrument", func(t *testing.T) {
 		f := randFileName(t)
 		if err := copy("./internal/testdata/instrumented/basic.go.exp", f); err != nil {
@@ -145,6 +986,38 @@ func TestApp(t *testing.T) {
 	})
 }
 
+// newModule makes module example in temporary directory with files copied from fixtures, keyed by path in module
+func newModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(path.Join(dir, "go.mod"), []byte("module example\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, from := range files {
+		f := path.Join(dir, name)
+		if err := os.MkdirAll(path.Dir(f), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := copy(from, f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// instrumentInModule instruments copy of fixture in new module by binary with args, and returns path of instrumented file
+func instrumentInModule(t *testing.T, testbin, fixture string, args ...string) string {
+	t.Helper()
+	f := path.Join(newModule(t, map[string]string{path.Base(fixture): fixture}), path.Base(fixture))
+
+	cmd := exec.Command(testbin, append(append([]string{"-w"}, args...), "-filename", f)...)
+	cmd.Env = append(cmd.Environ(), "GOCOVERDIR="+path.Join(wd(t), "coverage"))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Error(err, string(out))
+	}
+	return f
+}
+
 func assertEqFile(t *testing.T, a, b string) {
 	fa, _ := os.ReadFile(a)
 	fb, _ := os.ReadFile(b)
@@ -184,19 +1057,25 @@ func normalizeLineDirective(line string) string {
 
 func TestPanicLineNumbers(t *testing.T) {
 	testbin := path.Join(t.TempDir(), "go-instrument-testbin")
-	if err := exec.Command("go", "build", "-cover", "-o", testbin, "main.go").Run(); err != nil {
+	if err := exec.Command("go", "build", "-cover", "-o", testbin, ".").Run(); err != nil {
 		t.Fatal(err)
 	}
 
-	tests := []string{
-		"testdata/internal/panic1/main.go",
-		"testdata/internal/panic2/main.go",
-		"testdata/internal/panic3/main.go",
+	tests := []struct {
+		file string
+		args []string
+	}{
+		{file: "testdata/internal/panic1/main.go"},
+		{file: "testdata/internal/panic2/main.go"},
+		{file: "testdata/internal/panic3/main.go"},
+		{file: "testdata/internal/panic1/main.go", args: []string{"-record-panic"}},
+		{file: "testdata/internal/panic2/main.go", args: []string{"-record-panic"}},
+		{file: "testdata/internal/panic3/main.go", args: []string{"-record-panic"}},
 	}
 	for _, tc := range tests {
 		dir := t.TempDir()
 
-		if err := copy(tc, path.Join(dir, "main.go")); err != nil {
+		if err := copy(tc.file, path.Join(dir, "main.go")); err != nil {
 			t.Fatal(err)
 		}
 
@@ -209,10 +1088,10 @@ func TestPanicLineNumbers(t *testing.T) {
 
 		originalOutput, _ := exec.Command(originalBinary).CombinedOutput()
 
-		if err := copy(tc, path.Join(dir, "main_instrumented.go")); err != nil {
+		if err := copy(tc.file, path.Join(dir, "main_instrumented.go")); err != nil {
 			t.Fatal(err)
 		}
-		if err := exec.Command(testbin, "-w", "--preserve-line-numbers", "-filename", path.Join(dir, "main_instrumented.go")).Run(); err != nil {
+		if err := exec.Command(testbin, append(tc.args, "-w", "--preserve-line-numbers", "-filename", path.Join(dir, "main_instrumented.go"))...).Run(); err != nil {
 			t.Fatal(err)
 		}
 
@@ -236,12 +1115,52 @@ func TestPanicLineNumbers(t *testing.T) {
 		originalLines := extractLineNumbers(string(originalOutput))
 		instrumentedLines := extractLineNumbers(string(instrumentedOutput))
 
+		// recorded panic is panicked again, so frames of recovering function and runtime panic come before frames of original panic
+		if len(tc.args) > 0 {
+			originalFrames := extractFrames(string(originalOutput))
+			instrumentedFrames := withoutRepanics(extractFrames(string(instrumentedOutput)))
+			if len(originalFrames) == 0 || !slices.Equal(originalFrames, instrumentedFrames) {
+				t.Error(tc.file, originalFrames, instrumentedFrames, string(originalOutput), string(instrumentedOutput))
+			}
+			continue
+		}
+
 		if !slices.Equal(originalLines, instrumentedLines) {
 			t.Error(originalLines, instrumentedLines, string(originalOutput), string(instrumentedOutput))
 		}
 	}
 }
 
+// frame is function and line of goroutine traceback
+type frame struct {
+	function string
+	line     int
+}
+
+// extractFrames returns frames of traceback, numbers of anonymous functions are dropped, since inserted deferred functions shift them
+func extractFrames(output string) (frames []frame) {
+	re := regexp.MustCompile(`(?m)^(.+)\(.*\)\n\t.+\.go:(\d+)`)
+	anonymous := regexp.MustCompile(`\.func\d+`)
+	for _, match := range re.FindAllStringSubmatch(output, -1) {
+		if line, err := strconv.Atoi(match[2]); err == nil {
+			frames = append(frames, frame{function: anonymous.ReplaceAllString(match[1], ".func"), line: line})
+		}
+	}
+	return frames
+}
+
+// withoutRepanics removes frames of runtime panic, and frames of deferred functions that recover and panic again, that precede them
+func withoutRepanics(frames []frame) (out []frame) {
+	for _, q := range frames {
+		if q.function == "panic" && len(out) > 0 {
+			out = out[:len(out)-1]
+			continue
+		}
+		out = append(out, q)
+	}
+	return out
+}
+
 func extractLineNumbers(output string) (lines []int) {
 	re := regexp.MustCompile(`\.go:(\d+)`)
 	matches := re.FindAllStringSubmatch(output, -1)
@@ -255,6 +1174,14 @@ func extractLineNumbers(output string) (lines []int) {
 	return lines
 }
 
+func wd(t *testing.T) string {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
 func randFileName(t *testing.T) string {
 	return path.Join(t.TempDir(), time.Now().Format("20060102-150405-")+strconv.Itoa(rand.Int())+".go")
 }
@@ -0,0 +1,56 @@
+package processor
+
+import (
+	"go/ast"
+	"strconv"
+)
+
+// anonymousFuncNames names function literals after enclosing declaration and order of appearance, as Go runtime does.
+// Literals directly within declaration are func1, func2, and so on, literals within literals are func1.1, func1.2, and so on.
+// Literals outside of functions, such as in package level variables, are named within init.
+func (p *Processor) anonymousFuncNames(file *ast.File) map[*ast.FuncLit]FuncName {
+	names := make(map[*ast.FuncLit]FuncName)
+	counts := make(map[ast.Node]int)
+
+	var stack []ast.Node
+	ast.Inspect(file, func(node ast.Node) bool {
+		if node == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, node)
+
+		lit, ok := node.(*ast.FuncLit)
+		if !ok {
+			return true
+		}
+
+		var parent ast.Node = file
+		for i := len(stack) - 2; i >= 0; i-- {
+			if _, ok := stack[i].(*ast.FuncDecl); ok {
+				parent = stack[i]
+				break
+			}
+			if _, ok := stack[i].(*ast.FuncLit); ok {
+				parent = stack[i]
+				break
+			}
+		}
+
+		counts[parent]++
+		n := strconv.Itoa(counts[parent])
+
+		switch v := parent.(type) {
+		case *ast.FuncLit:
+			names[lit] = FuncName{Receiver: names[v].Receiver, PointerReceiver: names[v].PointerReceiver, Function: names[v].Function + "." + n}
+		case *ast.FuncDecl:
+			names[lit] = FuncName{Receiver: p.methodReceiverTypeName(v), PointerReceiver: p.isPointerReceiver(v), Function: p.functionName(v) + ".func" + n}
+		default:
+			names[lit] = FuncName{Function: "init.func" + n}
+		}
+
+		return true
+	})
+
+	return names
+}
@@ -0,0 +1,196 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// ContextSource extracts context from parameter or receiver of function without context parameter.
+// Templates are executed with ContextSourceData.
+type ContextSource struct {
+	Type      *regexp.Regexp // type as written in source (e.g. *gin.Context), or with package path when Types are set (e.g. *github.com/gin-gonic/gin.Context)
+	Receiver  bool           // match receiver instead of parameters
+	Context   string         // text/template of expression of context, e.g. {{.Name}}.Request.Context()
+	Writeback string         // text/template of statement that sets derived context back, so that callees get it, e.g. {{.Name}}.Request = {{.Name}}.Request.WithContext({{.Context}}), optional
+}
+
+// ContextSourceData is passed to templates of ContextSource
+type ContextSourceData struct {
+	Name    string // name of parameter or receiver
+	Context string // name of derived context variable
+}
+
+// DefaultContextSources extract context from *http.Request parameters
+var DefaultContextSources = []ContextSource{
+	{
+		Type:      regexp.MustCompile(`^\*(net/)?http\.Request$`),
+		Context:   "{{.Name}}.Context()",
+		Writeback: "{{.Name}} = {{.Name}}.WithContext({{.Context}})",
+	},
+}
+
+// Validate checks templates produce valid expression and statement
+func (s ContextSource) Validate() error {
+	if s.Type == nil {
+		return errors.New("context source: missing type")
+	}
+	data := ContextSourceData{Name: "x", Context: "ctx"}
+	if _, err := s.expr(data); err != nil {
+		return err
+	}
+	if _, err := s.writeback(data); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s ContextSource) expr(data ContextSourceData) (ast.Expr, error) {
+	src, err := executeTemplate(s.Context, data)
+	if err != nil {
+		return nil, err
+	}
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("context source: %q: %w", src, err)
+	}
+	resetPositions(expr)
+	return expr, nil
+}
+
+func (s ContextSource) writeback(data ContextSourceData) (ast.Stmt, error) {
+	if s.Writeback == "" {
+		return nil, nil
+	}
+	src, err := executeTemplate(s.Writeback, data)
+	if err != nil {
+		return nil, err
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "", "package p; func _() {\n"+src+"\n}", 0)
+	if err != nil {
+		return nil, fmt.Errorf("context source: %q: %w", src, err)
+	}
+	stmts := file.Decls[0].(*ast.FuncDecl).Body.List
+	if len(stmts) != 1 {
+		return nil, fmt.Errorf("context source: %q: expected single statement", src)
+	}
+	resetPositions(stmts[0])
+	return stmts[0], nil
+}
+
+func executeTemplate(text string, data ContextSourceData) (string, error) {
+	t, err := template.New("context").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("context source: %w", err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("context source: %w", err)
+	}
+	return b.String(), nil
+}
+
+// resetPositions clears positions of parsed node, so that it is printed as if constructed
+func resetPositions(node ast.Node) {
+	posType := reflect.TypeOf(token.NoPos)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		v := reflect.ValueOf(n)
+		if v.Kind() != reflect.Pointer || v.IsNil() {
+			return true
+		}
+		v = v.Elem()
+		if v.Kind() != reflect.Struct {
+			return true
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if f := v.Field(i); f.Type() == posType && f.CanSet() {
+				f.SetInt(int64(token.NoPos))
+			}
+		}
+		return true
+	})
+}
+
+// contextFromSource finds receiver or parameter that matches context source in function without context parameter.
+// It returns expression of context and statement that sets derived context back.
+func (p *Processor) contextFromSource(recv *ast.FieldList, fnType *ast.FuncType, contextName string) (ast.Expr, ast.Stmt, error) {
+	for _, s := range p.ContextSources {
+		var fields *ast.FieldList
+		if s.Receiver {
+			fields = recv
+		} else if fnType != nil {
+			fields = fnType.Params
+		}
+		if fields == nil {
+			continue
+		}
+		for _, q := range fields.List {
+			if q == nil || len(q.Names) != 1 || q.Names[0] == nil || q.Names[0].Name == "_" || !s.Type.MatchString(p.typeString(q.Type)) {
+				continue
+			}
+			data := ContextSourceData{Name: q.Names[0].Name, Context: contextName}
+			expr, err := s.expr(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			writeback, err := s.writeback(data)
+			if err != nil {
+				return nil, nil, err
+			}
+			return expr, writeback, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// contextSourceWritebacks returns printed writeback statements of context sources for each of context names
+func (p *Processor) contextSourceWritebacks(recv *ast.FieldList, fnType *ast.FuncType, contextNames []string) map[string]bool {
+	writebacks := make(map[string]bool)
+	for _, name := range contextNames {
+		_, stmt, err := p.contextFromSource(recv, fnType, name)
+		if err != nil || stmt == nil {
+			continue
+		}
+		var b bytes.Buffer
+		if err := format.Node(&b, token.NewFileSet(), stmt); err == nil {
+			writebacks[b.String()] = true
+		}
+	}
+	return writebacks
+}
+
+// typeString is type with package path by type information, otherwise as written in source
+func (p *Processor) typeString(e ast.Expr) string {
+	if p.TypesInfo != nil {
+		if t := p.TypesInfo.TypeOf(e); t != nil {
+			return types.TypeString(t, nil)
+		}
+	}
+	return types.ExprString(e)
+}
+
+// definesName checks that statements define variable with name
+func definesName(stmts []ast.Stmt, name string) bool {
+	for _, stmt := range stmts {
+		if v, ok := stmt.(*ast.AssignStmt); ok && v.Tok == token.DEFINE {
+			for _, q := range v.Lhs {
+				if ident, ok := q.(*ast.Ident); ok && ident.Name == name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
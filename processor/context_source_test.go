@@ -0,0 +1,34 @@
+package processor_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+func TestContextSource_Validate(t *testing.T) {
+	typ := regexp.MustCompile(`^\*gin\.Context$`)
+
+	tests := []struct {
+		name   string
+		source processor.ContextSource
+		ok     bool
+	}{
+		{name: "default", source: processor.DefaultContextSources[0], ok: true},
+		{name: "without writeback", source: processor.ContextSource{Type: typ, Context: "{{.Name}}.ctx"}, ok: true},
+		{name: "without type", source: processor.ContextSource{Context: "{{.Name}}.ctx"}},
+		{name: "unknown field", source: processor.ContextSource{Type: typ, Context: "{{.Unknown}}"}},
+		{name: "malformed template", source: processor.ContextSource{Type: typ, Context: "{{.Name"}},
+		{name: "invalid expression", source: processor.ContextSource{Type: typ, Context: "{{.Name}}.("}},
+		{name: "invalid writeback", source: processor.ContextSource{Type: typ, Context: "{{.Name}}.ctx", Writeback: "{{.Name}}.ctx ="}},
+		{name: "multiple writeback statements", source: processor.ContextSource{Type: typ, Context: "{{.Name}}.ctx", Writeback: "a(); b()"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.source.Validate(); (err == nil) != tc.ok {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,19 @@
+package processor
+
+import (
+	"regexp"
+	"slices"
+)
+
+// Filter selects names that match any of Include, or all if Include is empty, and none of Exclude
+type Filter struct {
+	Include, Exclude []*regexp.Regexp
+}
+
+func (f Filter) Match(s string) bool {
+	matches := func(r *regexp.Regexp) bool { return r.MatchString(s) }
+	if len(f.Include) > 0 && !slices.ContainsFunc(f.Include, matches) {
+		return false
+	}
+	return !slices.ContainsFunc(f.Exclude, matches)
+}
@@ -0,0 +1,57 @@
+package processor_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		filter processor.Filter
+		s      string
+		match  bool
+	}{
+		{
+			filter: processor.Filter{},
+			s:      "Cat.Name",
+			match:  true,
+		},
+		{
+			filter: processor.Filter{Include: []*regexp.Regexp{regexp.MustCompile(`^Cat\.`)}},
+			s:      "Cat.Name",
+			match:  true,
+		},
+		{
+			filter: processor.Filter{Include: []*regexp.Regexp{regexp.MustCompile(`^Cat\.`)}},
+			s:      "Dog.Name",
+			match:  false,
+		},
+		{
+			filter: processor.Filter{Include: []*regexp.Regexp{regexp.MustCompile(`^Dog\.`), regexp.MustCompile(`^Cat\.`)}},
+			s:      "Cat.Name",
+			match:  true,
+		},
+		{
+			filter: processor.Filter{Exclude: []*regexp.Regexp{regexp.MustCompile(`Name$`)}},
+			s:      "Cat.Name",
+			match:  false,
+		},
+		{
+			filter: processor.Filter{
+				Include: []*regexp.Regexp{regexp.MustCompile(`^Cat\.`)},
+				Exclude: []*regexp.Regexp{regexp.MustCompile(`Name$`)},
+			},
+			s:     "Cat.Name",
+			match: false,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.s, func(t *testing.T) {
+			if match := tc.filter.Match(tc.s); match != tc.match {
+				t.Error(match)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package processor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Fix is instrumentation of single function as edits of source, for tools that apply it selectively, like analyzers.
+// Edits of each fix include package level declarations and imports it requires, so fixes of the same file may overlap.
+type Fix struct {
+	Func  FuncInfo
+	Edits []Edit
+}
+
+// Edit replaces source from Pos up to End, not including End, with NewText
+type Edit struct {
+	Pos, End token.Pos
+	NewText  []byte
+}
+
+// Fixes finds functions to instrument and returns their instrumentation without changing file.
+// Line numbers are not preserved, since inserted statements are meant to be kept in source.
+func (p *Processor) Fixes(fset *token.FileSet, file *ast.File) ([]Fix, error) {
+	in, err := p.collect(fset, file)
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []Edit
+	for _, q := range in.decls {
+		edit, err := q.edit(fset)
+		if err != nil {
+			return nil, err
+		}
+		decls = append(decls, edit)
+	}
+
+	imported := make(map[string]bool)
+	for _, q := range file.Imports {
+		_, pkgPath := importName(q)
+		imported[pkgPath] = true
+	}
+	imports := append(p.funcInstrumenter().Imports(), in.declImports...)
+
+	var fixes []Fix
+	for _, fn := range in.funcs {
+		fix := Fix{Func: fn.info}
+		for _, q := range fn.patches {
+			edit, err := q.edit(fset)
+			if err != nil {
+				return nil, err
+			}
+			fix.Edits = append(fix.Edits, edit)
+		}
+		fix.Edits = append(fix.Edits, decls...)
+
+		var specs []string
+		for _, pkg := range imports {
+			name := pkg.Name()
+			if name == "" {
+				name = path.Base(pkg.Path())
+			}
+			spec := strconv.Quote(pkg.Path())
+			if pkg.Name() != "" {
+				spec = pkg.Name() + " " + spec
+			}
+			if !imported[pkg.Path()] && !slices.Contains(specs, spec) && usesQualifier(fix.Edits, name) {
+				specs = append(specs, spec)
+			}
+		}
+		if len(specs) > 0 {
+			slices.Sort(specs)
+			fix.Edits = append([]Edit{importEdit(file, specs)}, fix.Edits...)
+		}
+
+		fix.Edits = mergeEdits(fix.Edits)
+		fixes = append(fixes, fix)
+	}
+	return fixes, nil
+}
+
+// edit is patch as edit of source.
+// Statements are inserted on their own lines after line of opening brace of function, indented as first statement.
+func (patch patch) edit(fset *token.FileSet) (Edit, error) {
+	text, err := patch.text(fset, false)
+	if err != nil {
+		return Edit{}, err
+	}
+
+	// patch is at character after which source is inserted
+	edit := Edit{Pos: patch.pos + 1, End: patch.pos + 1, NewText: text}
+	if patch.end.IsValid() {
+		edit.End = patch.end + 1
+	}
+
+	if len(patch.stmts) == 0 || patch.fnBody == nil {
+		return edit, nil
+	}
+
+	indent, next := "\t", patch.fnBody.Rbrace
+	if len(patch.fnBody.List) > 0 {
+		next = patch.fnBody.List[0].Pos()
+	}
+	if line := fset.Position(patch.fnBody.Lbrace).Line; fset.Position(next).Line > line {
+		if len(patch.fnBody.List) > 0 {
+			indent = strings.Repeat("\t", fset.Position(next).Column-1)
+		}
+		edit.Pos = fset.File(next).LineStart(line + 1)
+		edit.End = edit.Pos
+		text = bytes.TrimPrefix(text, []byte("\n"))
+	}
+
+	lines := bytes.Split(text, []byte("\n"))
+	for i, line := range lines {
+		if len(line) > 0 {
+			lines[i] = append([]byte(indent), line...)
+		}
+	}
+	edit.NewText = bytes.Join(lines, []byte("\n"))
+	return edit, nil
+}
+
+// importEdit adds imports as new group of last import declaration, or as new import declaration
+func importEdit(file *ast.File, specs []string) Edit {
+	var last *ast.GenDecl
+	for _, decl := range file.Decls {
+		if v, ok := decl.(*ast.GenDecl); ok && v.Tok == token.IMPORT {
+			last = v
+		}
+	}
+	if last != nil && last.Rparen.IsValid() {
+		return Edit{Pos: last.Rparen, End: last.Rparen, NewText: []byte("\n\t" + strings.Join(specs, "\n\t") + "\n")}
+	}
+	pos := importsEnd(file)
+	return Edit{Pos: pos, End: pos, NewText: []byte("\n\nimport (\n\t" + strings.Join(specs, "\n\t") + "\n)")}
+}
+
+// usesQualifier checks that name is used as package qualifier in any of edits
+func usesQualifier(edits []Edit, name string) bool {
+	r := regexp.MustCompile(`\b` + regexp.QuoteMeta(name) + `\.`)
+	return slices.ContainsFunc(edits, func(e Edit) bool { return r.Match(e.NewText) })
+}
+
+// importsEnd is position after last import declaration, or after package name if there are none
+func importsEnd(file *ast.File) token.Pos {
+	end := file.Name.End()
+	for _, decl := range file.Decls {
+		if v, ok := decl.(*ast.GenDecl); ok && v.Tok == token.IMPORT {
+			end = v.End()
+		}
+	}
+	return end
+}
+
+// mergeEdits sorts edits by position and joins insertions at the same position in order of edits
+func mergeEdits(edits []Edit) []Edit {
+	slices.SortStableFunc(edits, func(a, b Edit) int { return int(a.Pos) - int(b.Pos) })
+	var merged []Edit
+	for _, q := range edits {
+		if n := len(merged); n > 0 && merged[n-1].Pos == q.Pos && merged[n-1].End == q.Pos && q.End == q.Pos {
+			merged[n-1].NewText = append(slices.Clone(merged[n-1].NewText), q.NewText...)
+			continue
+		}
+		merged = append(merged, q)
+	}
+	return merged
+}
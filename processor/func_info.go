@@ -0,0 +1,113 @@
+package processor
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// FuncInstrumenter supplies ast of Go code that will be inserted and required dependencies.
+// Unlike Instrumenter, it receives everything processor knows about function.
+type FuncInstrumenter interface {
+	Imports() []*types.Package
+	// FuncPrefixStatements returns statements inserted at start of function, nil skips function
+	FuncPrefixStatements(fn FuncInfo) []ast.Stmt
+}
+
+// FuncInfo describes function or method that is instrumented
+type FuncInfo struct {
+	Decl *ast.FuncDecl // nil for anonymous function
+	Lit  *ast.FuncLit  // nil for declared function
+	Type *ast.FuncType
+	Body *ast.BlockStmt
+	Doc  *ast.CommentGroup // nil for anonymous function
+
+	Name     FuncName
+	Receiver *Var // nil for function
+	Params   []Var
+	Results  []Var
+
+	Package  *types.Package // set when types are loaded
+	Position token.Position
+
+	SpanName    string
+	ContextName string   // name of context variable, that is defined by inserted statements if ContextExpr is set, or captured from enclosing function by goroutine
+	ContextExpr ast.Expr // expression of context when it is not parameter, e.g. r.Context() for *http.Request
+	HasError    bool
+	ErrorName   string
+
+	Goroutine bool // function literal is launched by go statement
+}
+
+// ParentContext is expression of context that span is started from
+func (fn FuncInfo) ParentContext() ast.Expr {
+	if fn.ContextExpr != nil {
+		return fn.ContextExpr
+	}
+	return &ast.Ident{Name: fn.ContextName}
+}
+
+// UnusedName returns name based on base that does not shadow or conflict with identifiers of function
+func (fn FuncInfo) UnusedName(base string) string {
+	var nodes []ast.Node
+	if fn.Type != nil {
+		nodes = append(nodes, fn.Type)
+	}
+	if fn.Body != nil {
+		nodes = append(nodes, fn.Body)
+	}
+	return unusedName(base, nodes...)
+}
+
+// Var is receiver, parameter, or result of function
+type Var struct {
+	Name string // empty if unnamed
+	Expr ast.Expr
+	Type types.Type // set when types are loaded, or for predeclared types like int and string
+}
+
+// BasicInstrumenter adapts Instrumenter to FuncInstrumenter.
+// Functions with context that is not parameter are skipped, since Instrumenter starts span from context variable.
+type BasicInstrumenter struct {
+	Instrumenter
+}
+
+func (s BasicInstrumenter) FuncPrefixStatements(fn FuncInfo) []ast.Stmt {
+	if fn.ContextExpr != nil {
+		return nil
+	}
+	return s.PrefixStatements(fn.SpanName, fn.ContextName, fn.HasError, fn.ErrorName)
+}
+
+func (p *Processor) vars(fields *ast.FieldList) []Var {
+	if fields == nil {
+		return nil
+	}
+	var vars []Var
+	for _, field := range fields.List {
+		if field == nil {
+			continue
+		}
+		t := p.typeOf(field.Type)
+		if len(field.Names) == 0 {
+			vars = append(vars, Var{Expr: field.Type, Type: t})
+		}
+		for _, name := range field.Names {
+			vars = append(vars, Var{Name: name.Name, Expr: field.Type, Type: t})
+		}
+	}
+	return vars
+}
+
+// typeOf is type of expression from types info, otherwise predeclared type
+func (p *Processor) typeOf(e ast.Expr) types.Type {
+	if p.TypesInfo != nil {
+		return p.TypesInfo.TypeOf(e)
+	}
+	if v, ok := e.(*ast.Ident); ok {
+		if obj, ok := types.Universe.Lookup(v.Name).(*types.TypeName); ok {
+			return obj.Type()
+		}
+	}
+	return nil
+}
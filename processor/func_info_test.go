@@ -0,0 +1,155 @@
+package processor_test
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+// recordingInstrumenter records functions and instruments only ones with doc comment
+type recordingInstrumenter struct {
+	funcs []processor.FuncInfo
+}
+
+func (s *recordingInstrumenter) Imports() []*types.Package { return nil }
+
+func (s *recordingInstrumenter) FuncPrefixStatements(fn processor.FuncInfo) []ast.Stmt {
+	s.funcs = append(s.funcs, fn)
+	if fn.Doc == nil {
+		return nil
+	}
+	return []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.Ident{Name: "trace"}, Args: []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"` + fn.SpanName + `"`}}}}}
+}
+
+func TestFuncInstrumenter(t *testing.T) {
+	src := `package example
+
+import "context"
+
+type Cat struct{}
+
+// Name is instrumented
+func (s *Cat) Name(ctx context.Context, id int, tags []string) (name string, err error) {
+	return "fluffer", nil
+}
+
+func Skipped(ctx context.Context) int {
+	return 42
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "example.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	instrumenter := &recordingInstrumenter{}
+	p := processor.Processor{
+		FuncInstrumenter: instrumenter,
+		SpanName:         processor.BasicSpanName,
+		ContextPackage:   "context",
+		ContextType:      "Context",
+		ErrorType:        "error",
+		PackagePath:      "example",
+	}
+	if err := p.Process(fset, file); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(instrumenter.funcs) != 2 {
+		t.Fatal(len(instrumenter.funcs))
+	}
+
+	fn := instrumenter.funcs[0]
+	if fn.Decl == nil || fn.Lit != nil || fn.SpanName != "Cat.Name" || fn.ContextName != "ctx" || !fn.HasError || fn.ErrorName != "err" {
+		t.Error(fn)
+	}
+	if fn.Name.PackagePath != "example" || fn.Name.PackageName != "example" || !fn.Name.PointerReceiver || fn.Position.Line != 8 {
+		t.Error(fn.Name, fn.Position)
+	}
+	if fn.Receiver == nil || fn.Receiver.Name != "s" {
+		t.Error(fn.Receiver)
+	}
+	if len(fn.Params) != 3 || fn.Params[1].Name != "id" || fn.Params[1].Type != types.Typ[types.Int] || fn.Params[2].Type != nil {
+		t.Error(fn.Params)
+	}
+	if len(fn.Results) != 2 || fn.Results[0].Name != "name" || fn.Results[0].Type != types.Typ[types.String] || fn.Results[1].Type != types.Universe.Lookup("error").Type() {
+		t.Error(fn.Results)
+	}
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `trace("Cat.Name")`) {
+		t.Error(out.String())
+	}
+	if !strings.Contains(out.String(), "func Skipped(ctx context.Context) int {\n\treturn 42\n}") {
+		t.Error("skipped function is changed", out.String())
+	}
+}
+
+// basicInstrumenter inserts call with span name, context, and error
+type basicInstrumenter struct{}
+
+func (basicInstrumenter) Imports() []*types.Package { return nil }
+
+func (basicInstrumenter) PrefixStatements(spanName string, contextName string, hasError bool, errName string) []ast.Stmt {
+	args := []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: `"` + spanName + `"`}, &ast.Ident{Name: contextName}}
+	if hasError {
+		args = append(args, &ast.Ident{Name: errName})
+	}
+	return []ast.Stmt{&ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.Ident{Name: "trace"}, Args: args}}}
+}
+
+func TestInstrumenter(t *testing.T) {
+	src := `package example
+
+import (
+	"context"
+	"net/http"
+)
+
+func Name(ctx context.Context) (name string, err error) {
+	return "fluffer", nil
+}
+
+func Handle(w http.ResponseWriter, r *http.Request) {
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "example.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := processor.Processor{
+		Instrumenter:   basicInstrumenter{},
+		SpanName:       processor.BasicSpanName,
+		ContextPackage: "context",
+		ContextType:    "Context",
+		ErrorType:      "error",
+		ContextSources: processor.DefaultContextSources,
+	}
+	if err := p.Process(fset, file); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	if err := format.Node(&out, fset, file); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `trace("Name", ctx, err)`) {
+		t.Error(out.String())
+	}
+	if !strings.Contains(out.String(), "func Handle(w http.ResponseWriter, r *http.Request) {\n}") {
+		t.Error("function without context parameter is changed", out.String())
+	}
+}
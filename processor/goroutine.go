@@ -0,0 +1,57 @@
+package processor
+
+import "go/ast"
+
+// launchedFuncs finds function literals launched by go statement, and function that encloses each function literal
+func launchedFuncs(file *ast.File) (launched map[*ast.FuncLit]bool, enclosing map[*ast.FuncLit]ast.Node) {
+	launched, enclosing = make(map[*ast.FuncLit]bool), make(map[*ast.FuncLit]ast.Node)
+	var stack []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case nil:
+			stack = stack[:len(stack)-1]
+			return true
+		case *ast.GoStmt:
+			if lit, ok := v.Call.Fun.(*ast.FuncLit); ok {
+				launched[lit] = true
+			}
+		case *ast.FuncLit:
+			for i := len(stack) - 1; i >= 0 && enclosing[v] == nil; i-- {
+				switch stack[i].(type) {
+				case *ast.FuncDecl, *ast.FuncLit:
+					enclosing[v] = stack[i]
+				}
+			}
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return launched, enclosing
+}
+
+// enclosingContext returns name of context in scope of function literal, that is captured from enclosing functions
+func enclosingContext(lit *ast.FuncLit, enclosing map[*ast.FuncLit]ast.Node, contexts map[ast.Node]string) string {
+	for fn := enclosing[lit]; fn != nil; {
+		if name, ok := contexts[fn]; ok {
+			return name
+		}
+		v, ok := fn.(*ast.FuncLit)
+		if !ok {
+			return ""
+		}
+		fn = enclosing[v]
+	}
+	return ""
+}
+
+// usesName checks that name is referred to in node
+func usesName(node ast.Node, name string) bool {
+	found := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if v, ok := n.(*ast.Ident); ok && v.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,121 @@
+package processor
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// import paths of packages that inserted instrumentation starts spans with
+const (
+	otelPath         = "go.opentelemetry.io/otel"
+	datadogTracePath = "gopkg.in/DataDog/dd-trace-go.v1/ddtrace/tracer"
+	runtimeTracePath = "runtime/trace"
+)
+
+// fileImports maps names of imports of file to their paths, blank and dot imports are skipped
+func fileImports(file *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, q := range file.Imports {
+		if name, pkgPath := importName(q); name != "_" && name != "." {
+			imports[name] = pkgPath
+		}
+	}
+	return imports
+}
+
+// isFunctionInstrumented checks first statement of function starts span, task, or region the way instrumenters insert it
+func (p *Processor) isFunctionInstrumented(imports map[string]string, body *ast.BlockStmt) bool {
+	if body == nil || len(body.List) == 0 {
+		return false
+	}
+	_, ok := p.startStmt(imports, body.List[0])
+	return ok
+}
+
+// startStmt checks statement is one of:
+//
+//	ctx, span := otel.Tracer("app").Start(ctx, "name", ...)
+//	ctx, span := tracer.Start(ctx, "name", ...) // tracer is declared by instrumenter, e.g. -tracer-var
+//	span, ctx := tracer.StartSpanFromContext(ctx, "name", ...) // dd-trace-go
+//	ctx, task := trace.NewTask(ctx, "name") // runtime/trace
+//	defer trace.StartRegion(ctx, "name").End() // runtime/trace
+//
+// and returns name of defined span or task, that is empty for region.
+// Packages are matched by import path, so aliased imports are matched as well.
+func (p *Processor) startStmt(imports map[string]string, stmt ast.Stmt) (string, bool) {
+	switch v := stmt.(type) {
+	case *ast.DeferStmt:
+		end, ok := v.Call.Fun.(*ast.SelectorExpr)
+		if !ok || end.Sel.Name != "End" || len(v.Call.Args) != 0 {
+			return "", false
+		}
+		call, ok := end.X.(*ast.CallExpr)
+		return "", ok && isStartCall(call, "StartRegion") && isPackageIdent(imports, call.Fun.(*ast.SelectorExpr).X, runtimeTracePath)
+	case *ast.AssignStmt:
+		if v.Tok != token.DEFINE || len(v.Lhs) != 2 || len(v.Rhs) != 1 {
+			return "", false
+		}
+		call, ok := v.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			return "", false
+		}
+		spanIdx := 1
+		switch {
+		case isStartCall(call, "Start"):
+			if !p.isTracer(imports, call.Fun.(*ast.SelectorExpr).X) {
+				return "", false
+			}
+		case isStartCall(call, "StartSpanFromContext"):
+			if !isPackageIdent(imports, call.Fun.(*ast.SelectorExpr).X, datadogTracePath) {
+				return "", false
+			}
+			spanIdx = 0
+		case isStartCall(call, "NewTask"):
+			if !isPackageIdent(imports, call.Fun.(*ast.SelectorExpr).X, runtimeTracePath) {
+				return "", false
+			}
+		default:
+			return "", false
+		}
+		span, ok := v.Lhs[spanIdx].(*ast.Ident)
+		if !ok || span.Name == "_" {
+			return "", false
+		}
+		return span.Name, true
+	}
+	return "", false
+}
+
+// isStartCall checks call is `X.name(parent, "span name", ...)`
+func isStartCall(call *ast.CallExpr, name string) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok || sel.Sel.Name != name || len(call.Args) < 2 {
+		return false
+	}
+	lit, ok := call.Args[1].(*ast.BasicLit)
+	return ok && lit.Kind == token.STRING
+}
+
+// isTracer checks expression is `otel.Tracer(...)` or name of package declaration of instrumenter
+func (p *Processor) isTracer(imports map[string]string, expr ast.Expr) bool {
+	switch v := expr.(type) {
+	case *ast.CallExpr:
+		sel, ok := v.Fun.(*ast.SelectorExpr)
+		return ok && sel.Sel.Name == "Tracer" && isPackageIdent(imports, sel.X, otelPath)
+	case *ast.Ident:
+		if instrumenter, ok := p.FuncInstrumenter.(PackageDeclInstrumenter); ok {
+			for _, q := range instrumenter.PackageDecls() {
+				if q.Name == v.Name {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isPackageIdent checks expression is name of import of package
+func isPackageIdent(imports map[string]string, expr ast.Expr, pkgPath string) bool {
+	v, ok := expr.(*ast.Ident)
+	return ok && imports[v.Name] == pkgPath
+}
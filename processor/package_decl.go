@@ -0,0 +1,106 @@
+package processor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/token"
+	"go/types"
+)
+
+// PackageDecl is package level declaration that inserted statements refer to, e.g. cached tracer
+type PackageDecl struct {
+	Name    string // declaration is not inserted if package already declares this name
+	Decl    ast.Decl
+	Imports []*types.Package
+}
+
+// PackageDeclInstrumenter is FuncInstrumenter that also supplies package level declarations.
+// Declarations are inserted once per package into file that has inserted statements.
+type PackageDeclInstrumenter interface {
+	PackageDecls() []PackageDecl
+}
+
+// packageDeclPatches makes patches that insert declarations after imports, and returns imports of inserted declarations
+func (p *Processor) packageDeclPatches(fset *token.FileSet, file *ast.File) ([]patch, []*types.Package, error) {
+	instrumenter, ok := p.FuncInstrumenter.(PackageDeclInstrumenter)
+	if !ok {
+		return nil, nil, nil
+	}
+
+	pos := importsEnd(file)
+
+	var patches []patch
+	var imports []*types.Package
+	for _, q := range instrumenter.PackageDecls() {
+		if p.PackageNames[q.Name] || DeclaredNames(file)[q.Name] {
+			continue
+		}
+		src, err := formatNodeToBytes(fset, q.Decl)
+		if err != nil {
+			return nil, nil, err
+		}
+		patches = append(patches, insertBefore(pos, "\n\n"+string(src)))
+		imports = append(imports, q.Imports...)
+	}
+	return patches, imports, nil
+}
+
+// unusedPackageDecls returns declarations of file that are the same as declarations of instrumenter and are not referred to in file
+func (p *Processor) unusedPackageDecls(fset *token.FileSet, file *ast.File) ([]ast.Decl, error) {
+	instrumenter, ok := p.FuncInstrumenter.(PackageDeclInstrumenter)
+	if !ok {
+		return nil, nil
+	}
+
+	var unused []ast.Decl
+	for _, q := range instrumenter.PackageDecls() {
+		src, err := formatNodeToBytes(token.NewFileSet(), q.Decl)
+		if err != nil {
+			return nil, err
+		}
+		for _, decl := range file.Decls {
+			declSrc, err := formatNodeToBytes(fset, decl)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(src, declSrc) {
+				continue
+			}
+			referred := false
+			for _, other := range file.Decls {
+				if other != decl && usesName(other, q.Name) {
+					referred = true
+				}
+			}
+			if !referred {
+				unused = append(unused, decl)
+			}
+		}
+	}
+	return unused, nil
+}
+
+// DeclaredNames are package level names declared in file
+func DeclaredNames(file *ast.File) map[string]bool {
+	names := make(map[string]bool)
+	for _, decl := range file.Decls {
+		switch v := decl.(type) {
+		case *ast.FuncDecl:
+			if v.Recv == nil {
+				names[v.Name.Name] = true
+			}
+		case *ast.GenDecl:
+			for _, spec := range v.Specs {
+				switch s := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range s.Names {
+						names[name.Name] = true
+					}
+				case *ast.TypeSpec:
+					names[s.Name.Name] = true
+				}
+			}
+		}
+	}
+	return names
+}
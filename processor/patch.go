@@ -9,12 +9,22 @@ import (
 	"sort"
 )
 
+// patch inserts source and statements right after character at pos.
+// If end is set, source after pos up to and including character at end is removed.
 type patch struct {
 	pos    token.Pos
+	end    token.Pos
+	src    []byte
 	stmts  []ast.Stmt
 	fnBody *ast.BlockStmt
 }
 
+// insertBefore makes patch that inserts source right before character at pos
+func insertBefore(pos token.Pos, src string) patch { return patch{pos: pos - 1, src: []byte(src)} }
+
+// deleteRange makes patch that removes source from pos up to end, not including end
+func deleteRange(pos, end token.Pos) patch { return patch{pos: pos - 1, end: end - 1} }
+
 func patchFile(fset *token.FileSet, file *ast.File, preserveLineNumbers bool, patches ...patch) error {
 	// patches must be applied in the ascending order, otherwise the modified source file will become corrupted.
 	sort.Slice(patches, func(i, j int) bool { return patches[i].pos < patches[j].pos })
@@ -24,33 +34,20 @@ func patchFile(fset *token.FileSet, file *ast.File, preserveLineNumbers bool, pa
 		return err
 	}
 
-	var buf bytes.Buffer
-
 	offset := int(file.FileStart) - 1
 	for _, patch := range patches {
-		buf.Reset()
-
-		if len(patch.stmts) > 0 {
-			buf.WriteRune('\n')
-			if err := format.Node(&buf, fset, patch.stmts); err != nil {
-				return err
-			}
-
-			// line directives to preserve line numbers of functions (for accurate panic stack traces)
-			// https://github.com/golang/go/blob/master/src/cmd/compile/doc.go#L171
-			if preserveLineNumbers && patch.fnBody != nil && len(patch.fnBody.List) > 0 {
-				buf.WriteString("\n/*line ")
-				buf.WriteString(fset.Position(patch.fnBody.List[0].Pos()).String())
-				buf.WriteString("*/")
-			}
-
-			buf.WriteRune('\n')
+		text, err := patch.text(fset, preserveLineNumbers)
+		if err != nil {
+			return err
 		}
 
-		pos := int(patch.pos) - offset
-		src = append(src[:pos], append(buf.Bytes(), src[pos:]...)...)
+		pos, end := int(patch.pos)-offset, int(patch.pos)-offset
+		if patch.end.IsValid() {
+			end = int(patch.end) - offset
+		}
+		src = append(src[:pos], append(text, src[end:]...)...)
 		// patch positions after need to be shifted up relative to updates in src by buffer
-		offset -= buf.Len()
+		offset -= len(text) - (end - pos)
 	}
 
 	// post-process the source to ensure line directives are immediately before statements
@@ -67,6 +64,31 @@ func patchFile(fset *token.FileSet, file *ast.File, preserveLineNumbers bool, pa
 	return nil
 }
 
+// text is source that patch inserts
+func (patch patch) text(fset *token.FileSet, preserveLineNumbers bool) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(patch.src)
+
+	if len(patch.stmts) > 0 {
+		buf.WriteRune('\n')
+		if err := format.Node(&buf, fset, patch.stmts); err != nil {
+			return nil, err
+		}
+
+		// line directives to preserve line numbers of functions (for accurate panic stack traces)
+		// https://github.com/golang/go/blob/master/src/cmd/compile/doc.go#L171
+		if preserveLineNumbers && patch.fnBody != nil && len(patch.fnBody.List) > 0 {
+			buf.WriteString("\n/*line ")
+			buf.WriteString(fset.Position(patch.fnBody.List[0].Pos()).String())
+			buf.WriteString("*/")
+		}
+
+		buf.WriteRune('\n')
+	}
+
+	return buf.Bytes(), nil
+}
+
 // cleanupLineDirectives removes whitespace between /*line*/ directives and following statements
 func cleanupLineDirectives(src []byte) []byte {
 	var buf bytes.Buffer
@@ -4,6 +4,9 @@ import (
 	"go/ast"
 	"go/token"
 	"go/types"
+	"regexp"
+	"strconv"
+	"strings"
 
 	"golang.org/x/tools/go/ast/astutil"
 )
@@ -14,21 +17,56 @@ type Instrumenter interface {
 	PrefixStatements(spanName string, contextName string, hasError bool, errName string) []ast.Stmt
 }
 
-// BasicSpanName is common notation of <class>.<method> or <pkg>.<func>
-func BasicSpanName(receiver, function string) string {
-	if receiver == "" {
-		return function
-	}
-	return receiver + "." + function
-}
-
 // Processor traverses AST, collects details on functions and methods, and invokes Instrumenter
 type Processor struct {
 	Instrumenter                Instrumenter
-	PreserveLineNumbers         bool // if true, use compile directives to preserve line numbers as if no instrumentation was applied
-	SpanName                    func(receiver, function string) string
-	ContextPackage, ContextType string // context is detected automatically based on matching package and symbol name
+	FuncInstrumenter            FuncInstrumenter // used instead of Instrumenter if set, otherwise Instrumenter is adapted by BasicInstrumenter
+	PreserveLineNumbers         bool             // if true, use compile directives to preserve line numbers as if no instrumentation was applied
+	SpanName                    func(fn FuncName) string
+	ReceiverTypeParams          bool   // if true, receiver of generic type includes type parameters, e.g. Cache[K,V]
+	AnonymousFuncLine           bool   // if true, name of anonymous function includes its line, e.g. Handle.func1:42
+	ContextPackage, ContextType string // context is detected automatically based on matching package and symbol name, package is import path when Types are set
 	ErrorType                   string // error is detected by error type
+	NameResults                 bool   // if true, unnamed results are named when one of them is error, so that returned error is recorded
+
+	// Goroutines instruments function literals without context that are launched by go statement,
+	// with span from context of enclosing function that is captured by them
+	Goroutines bool
+
+	// RootFunctions select functions without context by span name, that start root span from RootContext
+	RootFunctions []*regexp.Regexp
+
+	// RootContext is expression of context of root spans, context.Background() if empty.
+	// RootContextImport is import path of package that RootContext refers to.
+	RootContext, RootContextImport string
+
+	// ContextSources extract context from parameters or receiver of functions without context parameter, first match is used, see DefaultContextSources
+	ContextSources []ContextSource
+
+	// PackagePath is import path of package of processed file
+	PackagePath string
+
+	// PackageNames are package level names declared in other files of package, see PackageDeclInstrumenter
+	PackageNames map[string]bool
+
+	// Functions, Packages, Files select what to instrument by span name, package path, and file path.
+	// Functions that are not selected are left as is.
+	Functions, Packages, Files Filter
+
+	// Types and TypesInfo of package of processed file. If set, context and error are detected by type instead of matching identifiers.
+	// This handles aliased and dot imports, type aliases, interfaces that embed context, and concrete error types.
+	Types     *types.Package
+	TypesInfo *types.Info
+
+	contextType types.Type
+}
+
+// funcInstrumenter is FuncInstrumenter if set, otherwise Instrumenter adapted by BasicInstrumenter
+func (p *Processor) funcInstrumenter() FuncInstrumenter {
+	if p.FuncInstrumenter != nil {
+		return p.FuncInstrumenter
+	}
+	return BasicInstrumenter{p.Instrumenter}
 }
 
 func (p *Processor) methodReceiverTypeName(fn *ast.FuncDecl) string {
@@ -46,14 +84,36 @@ func (p *Processor) methodReceiverTypeName(fn *ast.FuncDecl) string {
 		if v, ok := v.Type.(*ast.StarExpr); ok {
 			t = v.X
 		}
+		// generic receiver
+		var typeParams []string
+		switch v := t.(type) {
+		case *ast.IndexExpr:
+			t, typeParams = v.X, []string{types.ExprString(v.Index)}
+		case *ast.IndexListExpr:
+			t = v.X
+			for _, q := range v.Indices {
+				typeParams = append(typeParams, types.ExprString(q))
+			}
+		}
 		// value/pointer receiver
 		if v, ok := t.(*ast.Ident); ok {
+			if p.ReceiverTypeParams && len(typeParams) > 0 {
+				return v.Name + "[" + strings.Join(typeParams, ",") + "]"
+			}
 			return v.Name
 		}
 	}
 	return ""
 }
 
+func (p *Processor) isPointerReceiver(fn *ast.FuncDecl) bool {
+	if fn == nil || fn.Recv == nil || len(fn.Recv.List) == 0 || fn.Recv.List[0] == nil {
+		return false
+	}
+	_, ok := fn.Recv.List[0].Type.(*ast.StarExpr)
+	return ok
+}
+
 func (p *Processor) functionName(fn *ast.FuncDecl) string {
 	if fn == nil || fn.Name == nil {
 		return ""
@@ -69,6 +129,13 @@ func (p *Processor) contextNameFromParam(e *ast.Field) string {
 		return ""
 	}
 
+	if p.TypesInfo != nil {
+		if ctx := e.Names[0].Name; ctx != "_" && p.isContextType(p.TypesInfo.TypeOf(e.Type)) {
+			return ctx
+		}
+		return ""
+	}
+
 	var pkg, sym string
 
 	if se, ok := e.Type.(*ast.SelectorExpr); ok && se != nil {
@@ -89,6 +156,43 @@ func (p *Processor) contextNameFromParam(e *ast.Field) string {
 	return ""
 }
 
+// isContextType is true when type is identical to or implements context
+func (p *Processor) isContextType(t types.Type) bool {
+	if t == nil || p.contextType == nil {
+		return false
+	}
+	iface, ok := p.contextType.Underlying().(*types.Interface)
+	if !ok {
+		return types.Identical(t, p.contextType)
+	}
+	return types.Implements(t, iface)
+}
+
+// lookupType finds named type in package or its transitive imports
+func lookupType(pkg *types.Package, path, name string) types.Type {
+	visited := make(map[*types.Package]bool)
+	var visit func(pkg *types.Package) types.Type
+	visit = func(pkg *types.Package) types.Type {
+		if pkg == nil || visited[pkg] {
+			return nil
+		}
+		visited[pkg] = true
+		if pkg.Path() == path {
+			if obj, ok := pkg.Scope().Lookup(name).(*types.TypeName); ok {
+				return obj.Type()
+			}
+			return nil
+		}
+		for _, q := range pkg.Imports() {
+			if t := visit(q); t != nil {
+				return t
+			}
+		}
+		return nil
+	}
+	return visit(pkg)
+}
+
 func (p *Processor) contextNameFromFunc(fnType *ast.FuncType) string {
 	if fnType == nil {
 		return ""
@@ -105,6 +209,35 @@ func (p *Processor) contextNameFromFunc(fnType *ast.FuncType) string {
 	return ""
 }
 
+// canReassignContext is false when context parameter is of custom type that implements context,
+// since derived context returned by tracer can not be assigned to it
+func (p *Processor) canReassignContext(fnType *ast.FuncType, contextName string) bool {
+	if p.TypesInfo == nil || fnType == nil || fnType.Params == nil {
+		return true
+	}
+	for _, q := range fnType.Params.List {
+		if len(q.Names) == 1 && q.Names[0] != nil && q.Names[0].Name == contextName {
+			return types.Identical(p.TypesInfo.TypeOf(q.Type), p.contextType)
+		}
+	}
+	return true
+}
+
+// discardContext replaces assignments to context in statements with blank identifier
+func discardContext(stmts []ast.Stmt, contextName string) {
+	for _, stmt := range stmts {
+		assignStmt, ok := stmt.(*ast.AssignStmt)
+		if !ok || assignStmt == nil {
+			continue
+		}
+		for i, q := range assignStmt.Lhs {
+			if v, ok := q.(*ast.Ident); ok && v != nil && v.Name == contextName {
+				assignStmt.Lhs[i] = &ast.Ident{Name: "_"}
+			}
+		}
+	}
+}
+
 func (p *Processor) isError(e *ast.Field) (ok bool, name string) {
 	if e == nil {
 		return false, ""
@@ -115,10 +248,33 @@ func (p *Processor) isError(e *ast.Field) (ok bool, name string) {
 	if len(e.Names) != 1 || e.Names[0] == nil {
 		return false, ""
 	}
-	if v, ok := e.Type.(*ast.Ident); ok && v != nil {
-		return v.Name == p.ErrorType, e.Names[0].Name
+	return p.isErrorTypeExpr(e.Type), e.Names[0].Name
+}
+
+func (p *Processor) isErrorTypeExpr(e ast.Expr) bool {
+	if p.TypesInfo != nil {
+		return isErrorType(p.TypesInfo.TypeOf(e))
+	}
+	v, ok := e.(*ast.Ident)
+	return ok && v != nil && v.Name == p.ErrorType
+}
+
+var errorInterface = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// isErrorType is true when type implements error and can be compared with nil
+func isErrorType(t types.Type) bool {
+	if t == nil {
+		return false
+	}
+	if _, ok := types.Unalias(t).(*types.TypeParam); ok {
+		return false
+	}
+	switch t.Underlying().(type) {
+	case *types.Pointer, *types.Interface:
+		return types.Implements(t, errorInterface)
+	default:
+		return false
 	}
-	return false, ""
 }
 
 func (p *Processor) functionHasError(fnType *ast.FuncType) (ok bool, name string) {
@@ -137,75 +293,279 @@ func (p *Processor) functionHasError(fnType *ast.FuncType) (ok bool, name string
 	return false, ""
 }
 
+// nameResults names unnamed results when one of them is error, so that returned error can be recorded.
+// Error is given name not used anywhere in function, other results are named with blank identifier.
+func (p *Processor) nameResults(fnType *ast.FuncType, fnBody *ast.BlockStmt) (patches []patch, errorName string) {
+	if fnType == nil || fnType.Results == nil || len(fnType.Results.List) == 0 {
+		return nil, ""
+	}
+
+	errorIdx := -1
+	for i, q := range fnType.Results.List {
+		if q == nil || len(q.Names) > 0 {
+			return nil, ""
+		}
+		if errorIdx < 0 && p.isErrorTypeExpr(q.Type) {
+			errorIdx = i
+		}
+	}
+	if errorIdx < 0 {
+		return nil, ""
+	}
+
+	errorName = unusedName("err", fnType, fnBody)
+
+	for i, q := range fnType.Results.List {
+		name := "_"
+		if i == errorIdx {
+			name = errorName
+		}
+		patches = append(patches, insertBefore(q.Type.Pos(), name+" "))
+	}
+
+	// single result without parenthesis
+	if !fnType.Results.Opening.IsValid() {
+		q := fnType.Results.List[0]
+		patches[0].src = append([]byte("("), patches[0].src...)
+		patches = append(patches, insertBefore(q.Type.End(), ")"))
+	}
+
+	return patches, errorName
+}
+
+// unusedName returns name that is not used by any identifier in nodes, by adding numeric suffix to base
+func unusedName(base string, nodes ...ast.Node) string {
+	used := make(map[string]bool)
+	for _, node := range nodes {
+		if node == nil {
+			continue
+		}
+		ast.Inspect(node, func(n ast.Node) bool {
+			if v, ok := n.(*ast.Ident); ok && v != nil {
+				used[v.Name] = true
+			}
+			return true
+		})
+	}
+
+	name := base
+	for i := 1; used[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	return name
+}
+
 func (p *Processor) Process(fset *token.FileSet, file *ast.File) error {
+	in, err := p.collect(fset, file)
+	if err != nil {
+		return err
+	}
+
+	patches := append(in.other, in.decls...)
+	for _, q := range in.funcs {
+		patches = append(patches, q.patches...)
+	}
+
+	if len(patches) > 0 {
+		if err := patchFile(fset, file, p.PreserveLineNumbers, patches...); err != nil {
+			return err
+		}
+		for _, pkg := range append(p.funcInstrumenter().Imports(), in.declImports...) {
+			astutil.AddNamedImport(fset, file, pkg.Name(), pkg.Path())
+		}
+	}
+
+	return nil
+}
+
+// funcPatches are patches that instrument single function
+type funcPatches struct {
+	info    FuncInfo
+	patches []patch
+}
+
+// instrumentation is collected from file before it is patched
+type instrumentation struct {
+	funcs       []funcPatches
+	decls       []patch          // package level declarations
+	declImports []*types.Package // imports of package level declarations and root context
+	other       []patch          // functions that are not instrumented
+}
+
+// collect finds functions to instrument and makes their patches, without changing file
+func (p *Processor) collect(fset *token.FileSet, file *ast.File) (in instrumentation, err error) {
 	for _, q := range buildConstraintsFromFile(*file) {
 		if q.SkipFile() {
-			return nil
+			return in, nil
 		}
 	}
 
-	var patches []patch
+	if !p.Packages.Match(p.PackagePath) || !p.Files.Match(fset.Position(file.Pos()).Filename) {
+		return in, nil
+	}
+
+	if p.Types != nil {
+		p.contextType = lookupType(p.Types, p.ContextPackage, p.ContextType)
+	}
+
+	anonymousNames := p.anonymousFuncNames(file)
+	imports := fileImports(file)
+
+	var inserted bool
+	var sourceErr error
+	var rootInserted bool
+
+	// contexts are names of context in scope of body of function, goroutines are launched by functions without context
+	var launched map[*ast.FuncLit]bool
+	var enclosing map[*ast.FuncLit]ast.Node
+	if p.Goroutines {
+		launched, enclosing = launchedFuncs(file)
+	}
+	contexts := make(map[ast.Node]string)
+	var goroutines []FuncInfo
+
+	// instrument inserts prefix statements into function, and reports whether they are inserted and define context
+	instrument := func(info FuncInfo, writeback ast.Stmt) (ok, defined bool) {
+		fnType, fnBody, contextName := info.Type, info.Body, info.ContextName
+
+		hasError, errorName := p.functionHasError(fnType)
+		var resultPatches []patch
+		if !hasError && p.NameResults {
+			if resultPatches, errorName = p.nameResults(fnType, fnBody); len(resultPatches) > 0 {
+				hasError = true
+			}
+		}
+
+		info.Params, info.Results = p.vars(fnType.Params), p.vars(fnType.Results)
+		info.HasError, info.ErrorName = hasError, errorName
+
+		ps := p.funcInstrumenter().FuncPrefixStatements(info)
+		if ps == nil {
+			return false, false
+		}
+		// goroutine does not define context when it does not use it or defines it itself, since captured context is not in scope of its body
+		if !p.canReassignContext(fnType, contextName) || (info.ContextExpr != nil && writeback == nil) || (info.Goroutine && (!usesName(fnBody, contextName) || definesName(fnBody.List, contextName))) {
+			discardContext(ps, contextName)
+		}
+		if writeback != nil && definesName(ps, contextName) {
+			ps = append(ps, writeback)
+		}
+		in.funcs = append(in.funcs, funcPatches{info: info, patches: append(resultPatches, patch{pos: fnBody.Pos(), stmts: ps, fnBody: fnBody})})
+		inserted = true
+		return true, definesName(ps, contextName)
+	}
 
 	astutil.Apply(file, nil, func(c *astutil.Cursor) bool {
 		if c == nil {
 			return true
 		}
 
-		var receiver, fname string
-		var fnType *ast.FuncType
-		var fnBody *ast.BlockStmt
+		var info FuncInfo
 
 		switch fn := c.Node().(type) {
 		case *ast.FuncLit:
-			fnType, fnBody = fn.Type, fn.Body
-			fname = "anonymous"
+			info = FuncInfo{Lit: fn, Type: fn.Type, Body: fn.Body, Name: anonymousNames[fn], Goroutine: launched[fn]}
+			if p.AnonymousFuncLine {
+				info.Name.Function += ":" + strconv.Itoa(fset.Position(fn.Pos()).Line)
+			}
 		case *ast.FuncDecl:
-			fnType, fnBody = fn.Type, fn.Body
-			fname = p.functionName(fn)
-			receiver = p.methodReceiverTypeName(fn)
+			info = FuncInfo{Decl: fn, Type: fn.Type, Body: fn.Body, Doc: fn.Doc}
+			info.Name = FuncName{Receiver: p.methodReceiverTypeName(fn), PointerReceiver: p.isPointerReceiver(fn), Function: p.functionName(fn)}
+			if vars := p.vars(fn.Recv); len(vars) == 1 {
+				info.Receiver = &vars[0]
+			}
 		default:
 			return true
 		}
 
-		if contextName := p.contextNameFromFunc(fnType); contextName != "" {
-			if p.isFunctionInstrumented(fnBody) {
+		fnType, fnBody := info.Type, info.Body
+
+		info.Name.PackagePath, info.Name.PackageName, info.Name.File = p.PackagePath, file.Name.Name, fset.Position(file.Pos()).Filename
+		info.SpanName = p.SpanName(info.Name)
+
+		contextName := p.contextNameFromFunc(fnType)
+		var writeback ast.Stmt
+		var root bool
+		if contextName == "" && fnBody != nil {
+			var recv *ast.FieldList
+			nodes := []ast.Node{fnType, fnBody}
+			if info.Decl != nil && info.Decl.Recv != nil {
+				recv = info.Decl.Recv
+				nodes = append(nodes, recv)
+			}
+			name := unusedName("ctx", nodes...)
+			var err error
+			if info.ContextExpr, writeback, err = p.contextFromSource(recv, fnType, name); err != nil {
+				if sourceErr == nil {
+					sourceErr = err
+				}
 				return true
 			}
+			if info.ContextExpr == nil && p.isRootFunction(info.SpanName) {
+				if info.ContextExpr, err = p.rootContext(); err != nil {
+					if sourceErr == nil {
+						sourceErr = err
+					}
+					return true
+				}
+				root = true
+			}
+			if info.ContextExpr != nil {
+				contextName = name
+			}
+		}
+
+		info.Package, info.Position = p.Types, fset.Position(c.Node().Pos())
 
-			hasError, errorName := p.functionHasError(fnType)
-			ps := p.Instrumenter.PrefixStatements(p.SpanName(receiver, fname), contextName, hasError, errorName)
-			patches = append(patches, patch{pos: fnBody.Pos(), stmts: ps, fnBody: fnBody})
+		if contextName != "" && fnBody != nil {
+			if info.ContextExpr == nil {
+				contexts[c.Node()] = contextName
+			}
+			if p.isFunctionInstrumented(imports, fnBody) {
+				if definesName(fnBody.List[:1], contextName) {
+					contexts[c.Node()] = contextName
+				}
+				return true
+			}
+			if !p.Functions.Match(info.SpanName) {
+				return true
+			}
+
+			info.ContextName = contextName
+			ok, defined := instrument(info, writeback)
+			if defined {
+				contexts[c.Node()] = contextName
+			}
+			rootInserted = rootInserted || (root && ok)
 		} else if fnBody != nil {
-			patches = append(patches, patch{pos: fnBody.Pos(), stmts: nil, fnBody: fnBody})
+			in.other = append(in.other, patch{pos: fnBody.Pos(), stmts: nil, fnBody: fnBody})
+			if info.Goroutine && !p.isFunctionInstrumented(imports, fnBody) && p.Functions.Match(info.SpanName) {
+				goroutines = append(goroutines, info)
+			}
 		}
 
 		return true
 	})
 
-	if len(patches) > 0 {
-		if err := patchFile(fset, file, p.PreserveLineNumbers, patches...); err != nil {
-			return err
-		}
-		for _, pkg := range p.Instrumenter.Imports() {
-			astutil.AddNamedImport(fset, file, pkg.Name(), pkg.Path())
-		}
+	if sourceErr != nil {
+		return in, sourceErr
 	}
 
-	return nil
-}
-
-func (p *Processor) isFunctionInstrumented(body *ast.BlockStmt) bool {
-	if body == nil || len(body.List) < 2 {
-		return false
+	// goroutines start span from context of enclosing function, that is captured by function literal
+	for _, info := range goroutines {
+		if info.ContextName = enclosingContext(info.Lit, enclosing, contexts); info.ContextName != "" {
+			instrument(info, nil)
+		}
 	}
-	// check first statement is `..., span := ...`
-	// this is already a strong signal that this is likely instrumentation
-	assignStmt, ok := body.List[0].(*ast.AssignStmt)
-	if !ok || assignStmt == nil || len(assignStmt.Lhs) != 2 || len(assignStmt.Rhs) != 1 {
-		return false
+
+	if inserted {
+		if in.decls, in.declImports, err = p.packageDeclPatches(fset, file); err != nil {
+			return in, err
+		}
 	}
-	if s, ok := assignStmt.Lhs[1].(*ast.Ident); !ok || s == nil || s.Name != "span" {
-		return false
+	if pkg := p.rootContextImport(); rootInserted && pkg != nil {
+		in.declImports = append(in.declImports, pkg)
 	}
-	return true
+
+	return in, nil
 }
@@ -0,0 +1,401 @@
+package processor
+
+import (
+	"bytes"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Remove deletes previously inserted instrumentation and line directives,
+// and package level declarations of instrumenter and imports that are not used after that.
+func (p *Processor) Remove(fset *token.FileSet, file *ast.File) error {
+	for _, q := range buildConstraintsFromFile(*file) {
+		if q.SkipFile() {
+			return nil
+		}
+	}
+
+	imports := fileImports(file)
+
+	var patches []patch
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		var recv *ast.FieldList
+		var fnType *ast.FuncType
+		var fnBody *ast.BlockStmt
+		switch fn := node.(type) {
+		case *ast.FuncLit:
+			fnType, fnBody = fn.Type, fn.Body
+		case *ast.FuncDecl:
+			recv, fnType, fnBody = fn.Recv, fn.Type, fn.Body
+		default:
+			return true
+		}
+
+		if !p.isFunctionInstrumented(imports, fnBody) {
+			return true
+		}
+
+		stmts := fnBody.List
+		span, _ := p.startStmt(imports, stmts[0])
+		writebacks := p.contextSourceWritebacks(recv, fnType, definedNames(stmts[0]))
+		n, directive := instrumentationLen(fset, file, imports, span, stmts, writebacks)
+
+		if p.NameResults {
+			patches = append(patches, p.unnameResults(fnType, stmts[n:])...)
+		}
+
+		if n == len(stmts) {
+			// line of removed statements is removed too, unless comments follow them
+			end := fnBody.Rbrace
+			if c := firstComment(file, stmts[n-1].End(), end); c != nil {
+				end = c.Pos()
+			}
+			patches = append(patches, deleteRange(stmts[0].Pos(), end))
+			return true
+		}
+
+		// comments before first original statement are kept
+		end := stmts[n].Pos()
+		if c := firstComment(file, stmts[n-1].End(), end); c != nil {
+			end = c.Pos()
+		}
+		patches = append(patches, deleteRange(stmts[0].Pos(), end))
+
+		if directive != nil && directive.Pos() >= end {
+			patches = append(patches, deleteRange(directive.Pos(), stmts[n].Pos()))
+		}
+
+		return true
+	})
+
+	usedBefore := usedImportNames(file)
+
+	if len(patches) > 0 {
+		if err := patchFile(fset, file, false, patches...); err != nil {
+			return err
+		}
+	}
+
+	// package level declarations are removed after statements that refer to them
+	decls, err := p.unusedPackageDecls(fset, file)
+	if err != nil {
+		return err
+	}
+	if len(patches) == 0 && len(decls) == 0 {
+		return nil
+	}
+	if len(decls) > 0 {
+		var declPatches []patch
+		for _, q := range decls {
+			declPatches = append(declPatches, deleteRange(q.Pos(), q.End()))
+		}
+		if err := patchFile(fset, file, false, declPatches...); err != nil {
+			return err
+		}
+	}
+
+	usedAfter := usedImportNames(file)
+
+	var unused []*ast.ImportSpec
+	for _, q := range file.Imports {
+		if name, _ := importName(q); usedBefore[name] && !usedAfter[name] {
+			unused = append(unused, q)
+		}
+	}
+	for _, q := range unused {
+		_, pkgPath := importName(q)
+		astutil.DeleteNamedImport(fset, file, importSpecName(q), pkgPath)
+	}
+
+	return nil
+}
+
+// unnameResults removes names of results that are given by nameResults: blank identifiers and name of error that original statements do not refer to.
+// Parenthesis of single result are removed too.
+func (p *Processor) unnameResults(fnType *ast.FuncType, stmts []ast.Stmt) []patch {
+	if fnType == nil || fnType.Results == nil || len(fnType.Results.List) == 0 {
+		return nil
+	}
+
+	errorName := ""
+	for _, q := range fnType.Results.List {
+		if q == nil || len(q.Names) != 1 {
+			return nil
+		}
+		if name := q.Names[0].Name; name != "_" {
+			if errorName != "" || !generatedErrorName.MatchString(name) || !p.isErrorTypeExpr(q.Type) {
+				return nil
+			}
+			errorName = name
+		}
+	}
+	if errorName == "" {
+		return nil
+	}
+
+	for _, stmt := range stmts {
+		if usesName(stmt, errorName) || hasBareReturn(stmt) {
+			return nil
+		}
+	}
+
+	var patches []patch
+	for _, q := range fnType.Results.List {
+		patches = append(patches, deleteRange(q.Names[0].Pos(), q.Type.Pos()))
+	}
+	if len(fnType.Results.List) == 1 && fnType.Results.Opening.IsValid() {
+		q := fnType.Results.List[0]
+		patches = append(patches, deleteRange(fnType.Results.Opening, q.Names[0].Pos()), deleteRange(q.Type.End(), fnType.Results.Closing+1))
+	}
+	return patches
+}
+
+// generatedErrorName matches names that nameResults gives to error
+var generatedErrorName = regexp.MustCompile(`^err[0-9]*$`)
+
+// hasBareReturn checks that statement has return without results, not counting function literals
+func hasBareReturn(stmt ast.Stmt) bool {
+	found := false
+	ast.Inspect(stmt, func(n ast.Node) bool {
+		switch v := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.ReturnStmt:
+			if len(v.Results) == 0 {
+				found = true
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// instrumentationLen returns number of leading statements inserted by instrumentation and line directive that follows them.
+// Statements after start of span are counted when they are deferred instrumentation of span or writebacks of context,
+// line directive is returned only when it marks first statement after them.
+func instrumentationLen(fset *token.FileSet, file *ast.File, imports map[string]string, span string, stmts []ast.Stmt, writebacks map[string]bool) (int, *ast.Comment) {
+	n := 1
+	for n < len(stmts) && (isDeferredInstrumentation(imports, span, stmts[n]) || isWriteback(fset, stmts[n], writebacks)) {
+		n++
+	}
+	if n == len(stmts) {
+		return n, nil
+	}
+	for _, c := range file.Comments {
+		for _, q := range c.List {
+			if q.Pos() >= stmts[n-1].End() && q.End() <= stmts[n].Pos() && strings.HasPrefix(q.Text, "/*line ") {
+				return n, q
+			}
+		}
+	}
+	return n, nil
+}
+
+// firstComment returns first comment within range
+func firstComment(file *ast.File, pos, end token.Pos) *ast.Comment {
+	for _, c := range file.Comments {
+		for _, q := range c.List {
+			if q.Pos() >= pos && q.End() <= end {
+				return q
+			}
+		}
+	}
+	return nil
+}
+
+// isDeferredInstrumentation checks statement is one of deferred statements that instrumenters insert after start of span:
+//
+//	defer span.End()
+//	defer func() { span.SetAttributes(...) }()
+//	defer func() {
+//		if err != nil {
+//			span.SetStatus(...) // or trace.Log(...)
+//		} else {
+//			span.Finish()
+//		}
+//	}()
+//	defer func() {
+//		if r := recover(); r != nil {
+//			span.RecordError(...)
+//			panic(r)
+//		}
+//	}()
+func isDeferredInstrumentation(imports map[string]string, span string, stmt ast.Stmt) bool {
+	v, ok := stmt.(*ast.DeferStmt)
+	if !ok || len(v.Call.Args) != 0 {
+		return false
+	}
+	if sel, ok := v.Call.Fun.(*ast.SelectorExpr); ok {
+		return isSpanCall(span, v.Call) && (sel.Sel.Name == "End" || sel.Sel.Name == "Finish")
+	}
+	fn, ok := v.Call.Fun.(*ast.FuncLit)
+	if !ok || fn.Type.Params.NumFields() != 0 || fn.Type.Results.NumFields() != 0 || len(fn.Body.List) == 0 {
+		return false
+	}
+	for _, q := range fn.Body.List {
+		switch q := q.(type) {
+		case *ast.ExprStmt:
+			if !isInstrumentationCall(imports, span, q) {
+				return false
+			}
+		case *ast.IfStmt:
+			if !isInstrumentationIf(imports, span, q) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// isInstrumentationIf checks statement is `if err != nil { ... } else { ... }` or `if r := recover(); r != nil { ...; panic(r) }`,
+// with blocks of instrumentation calls
+func isInstrumentationIf(imports map[string]string, span string, stmt *ast.IfStmt) bool {
+	cond, ok := stmt.Cond.(*ast.BinaryExpr)
+	if !ok || cond.Op != token.NEQ || !isIdent(cond.Y, "nil") {
+		return false
+	}
+	x, ok := cond.X.(*ast.Ident)
+	if !ok {
+		return false
+	}
+
+	body := stmt.Body.List
+	if stmt.Init != nil {
+		// recovered value is recorded and panic continues
+		init, ok := stmt.Init.(*ast.AssignStmt)
+		if !ok || init.Tok != token.DEFINE || len(init.Lhs) != 1 || len(init.Rhs) != 1 || !isIdent(init.Lhs[0], x.Name) || !isBuiltinCall(init.Rhs[0], "recover") || stmt.Else != nil {
+			return false
+		}
+		if len(body) == 0 {
+			return false
+		}
+		last, ok := body[len(body)-1].(*ast.ExprStmt)
+		if !ok || !isBuiltinCall(last.X, "panic", x.Name) {
+			return false
+		}
+		body = body[:len(body)-1]
+	}
+
+	var elseBody []ast.Stmt
+	if stmt.Else != nil {
+		v, ok := stmt.Else.(*ast.BlockStmt)
+		if !ok {
+			return false
+		}
+		elseBody = v.List
+	}
+
+	for _, q := range append(slices.Clone(body), elseBody...) {
+		if v, ok := q.(*ast.ExprStmt); !ok || !isInstrumentationCall(imports, span, v) {
+			return false
+		}
+	}
+	return len(body) > 0
+}
+
+// isInstrumentationCall checks statement is call of method of span, or trace.Log of runtime/trace
+func isInstrumentationCall(imports map[string]string, span string, stmt *ast.ExprStmt) bool {
+	call, ok := stmt.X.(*ast.CallExpr)
+	if !ok {
+		return false
+	}
+	if isSpanCall(span, call) {
+		return true
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && sel.Sel.Name == "Log" && isPackageIdent(imports, sel.X, runtimeTracePath)
+}
+
+// isSpanCall checks call is method of span
+func isSpanCall(span string, call *ast.CallExpr) bool {
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	return ok && span != "" && isIdent(sel.X, span)
+}
+
+// isBuiltinCall checks expression is call of builtin function with identifiers as arguments
+func isBuiltinCall(expr ast.Expr, name string, args ...string) bool {
+	call, ok := expr.(*ast.CallExpr)
+	if !ok || !isIdent(call.Fun, name) || len(call.Args) != len(args) {
+		return false
+	}
+	for i, q := range args {
+		if !isIdent(call.Args[i], q) {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	v, ok := expr.(*ast.Ident)
+	return ok && v.Name == name
+}
+
+// isWriteback checks statement is one of writebacks of context sources
+func isWriteback(fset *token.FileSet, stmt ast.Stmt, writebacks map[string]bool) bool {
+	if len(writebacks) == 0 {
+		return false
+	}
+	var b bytes.Buffer
+	if err := format.Node(&b, fset, stmt); err != nil {
+		return false
+	}
+	return writebacks[b.String()]
+}
+
+// definedNames returns names defined by statement
+func definedNames(stmt ast.Stmt) []string {
+	v, ok := stmt.(*ast.AssignStmt)
+	if !ok || v.Tok != token.DEFINE {
+		return nil
+	}
+	var names []string
+	for _, q := range v.Lhs {
+		if ident, ok := q.(*ast.Ident); ok && ident.Name != "_" {
+			names = append(names, ident.Name)
+		}
+	}
+	return names
+}
+
+// usedImportNames collects names that are used as package qualifiers in file
+func usedImportNames(file *ast.File) map[string]bool {
+	used := make(map[string]bool)
+	for _, decl := range file.Decls {
+		ast.Inspect(decl, func(n ast.Node) bool {
+			if v, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := v.X.(*ast.Ident); ok {
+					used[x.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	return used
+}
+
+func importName(spec *ast.ImportSpec) (name, pkgPath string) {
+	pkgPath, _ = strconv.Unquote(spec.Path.Value)
+	if spec.Name != nil {
+		return spec.Name.Name, pkgPath
+	}
+	return path.Base(pkgPath), pkgPath
+}
+
+func importSpecName(spec *ast.ImportSpec) string {
+	if spec.Name == nil {
+		return ""
+	}
+	return spec.Name.Name
+}
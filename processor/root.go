@@ -0,0 +1,40 @@
+package processor
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"regexp"
+	"slices"
+)
+
+// isRootFunction checks function without context is selected to start root span
+func (p *Processor) isRootFunction(spanName string) bool {
+	return slices.ContainsFunc(p.RootFunctions, func(r *regexp.Regexp) bool { return r.MatchString(spanName) })
+}
+
+// rootContext returns expression of context of root spans
+func (p *Processor) rootContext() (ast.Expr, error) {
+	src := p.RootContext
+	if src == "" {
+		src = "context.Background()"
+	}
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		return nil, fmt.Errorf("root context: %q: %w", src, err)
+	}
+	resetPositions(expr)
+	return expr, nil
+}
+
+// rootContextImport returns package that expression of context of root spans refers to, if any
+func (p *Processor) rootContextImport() *types.Package {
+	if p.RootContext == "" {
+		return types.NewPackage("context", "")
+	}
+	if p.RootContextImport == "" {
+		return nil
+	}
+	return types.NewPackage(p.RootContextImport, "")
+}
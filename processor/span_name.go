@@ -0,0 +1,62 @@
+package processor
+
+import (
+	"strings"
+	"text/template"
+)
+
+// FuncName describes function or method that span is named after
+type FuncName struct {
+	PackagePath     string // import path of package, e.g. github.com/org/svc/store
+	PackageName     string // e.g. store
+	File            string // path of file
+	Receiver        string // type name of method receiver, e.g. Cat
+	PointerReceiver bool   // if true, method receiver is pointer, e.g. *Cat
+	Function        string // e.g. Name, or Name.func1 for anonymous function
+}
+
+// BasicSpanName is common notation of <class>.<method> or <pkg>.<func>
+func BasicSpanName(fn FuncName) string {
+	if fn.Receiver == "" {
+		return fn.Function
+	}
+	return fn.Receiver + "." + fn.Function
+}
+
+// PackageSpanName qualifies BasicSpanName by package name, e.g. store.Cat.Name
+func PackageSpanName(fn FuncName) string {
+	if fn.PackageName == "" {
+		return BasicSpanName(fn)
+	}
+	return fn.PackageName + "." + BasicSpanName(fn)
+}
+
+// FullSpanName qualifies function by import path as runtime.FuncForPC does, e.g. github.com/org/svc/store.(*Cat).Name
+func FullSpanName(fn FuncName) string {
+	pkg := fn.PackagePath
+	if pkg == "" {
+		pkg = fn.PackageName
+	}
+	receiver := fn.Receiver
+	if fn.PointerReceiver {
+		receiver = "(*" + receiver + ")"
+	}
+	return strings.TrimPrefix(pkg+".", ".") + BasicSpanName(FuncName{Receiver: receiver, Function: fn.Function})
+}
+
+// TemplateSpanName names span by executing text/template with FuncName, e.g. {{.PackageName}}/{{.Function}}
+func TemplateSpanName(text string) (func(fn FuncName) string, error) {
+	t, err := template.New("span").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	// fields are checked on execution only
+	if err := t.Execute(&strings.Builder{}, FuncName{}); err != nil {
+		return nil, err
+	}
+	return func(fn FuncName) string {
+		var b strings.Builder
+		t.Execute(&b, fn)
+		return b.String()
+	}, nil
+}
@@ -0,0 +1,54 @@
+package processor_test
+
+import (
+	"testing"
+
+	"github.com/nikolaydubina/go-instrument/processor"
+)
+
+func TestSpanName(t *testing.T) {
+	method := processor.FuncName{PackagePath: "github.com/org/svc/store", PackageName: "store", File: "store/cat.go", Receiver: "Cat", PointerReceiver: true, Function: "Name"}
+	function := processor.FuncName{PackagePath: "github.com/org/svc/store", PackageName: "store", File: "store/cat.go", Function: "Fetch"}
+	anonymous := processor.FuncName{PackagePath: "github.com/org/svc/store", PackageName: "store", File: "store/cat.go", Receiver: "Cat", Function: "Name.func1"}
+	noPath := processor.FuncName{PackageName: "store", Receiver: "Cat", PointerReceiver: true, Function: "Name"}
+
+	template, err := processor.TemplateSpanName("{{.PackageName}}/{{.Receiver}}/{{.Function}}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		spanName func(fn processor.FuncName) string
+		fn       processor.FuncName
+		exp      string
+	}{
+		{spanName: processor.BasicSpanName, fn: method, exp: "Cat.Name"},
+		{spanName: processor.BasicSpanName, fn: function, exp: "Fetch"},
+		{spanName: processor.PackageSpanName, fn: method, exp: "store.Cat.Name"},
+		{spanName: processor.PackageSpanName, fn: function, exp: "store.Fetch"},
+		{spanName: processor.FullSpanName, fn: method, exp: "github.com/org/svc/store.(*Cat).Name"},
+		{spanName: processor.FullSpanName, fn: function, exp: "github.com/org/svc/store.Fetch"},
+		{spanName: processor.FullSpanName, fn: anonymous, exp: "github.com/org/svc/store.Cat.Name.func1"},
+		{spanName: processor.FullSpanName, fn: noPath, exp: "store.(*Cat).Name"},
+		{spanName: template, fn: method, exp: "store/Cat/Name"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.exp, func(t *testing.T) {
+			if got := tc.spanName(tc.fn); got != tc.exp {
+				t.Error(got, tc.exp)
+			}
+		})
+	}
+
+	t.Run("when template has unknown field, then error", func(t *testing.T) {
+		if _, err := processor.TemplateSpanName("{{.Unknown}}"); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("when template is malformed, then error", func(t *testing.T) {
+		if _, err := processor.TemplateSpanName("{{.Function"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}